@@ -0,0 +1,184 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// googleIssuers are the issuers of Google-signed ID tokens.
+var googleIssuers = map[string]bool{
+	"https://accounts.google.com": true,
+	"accounts.google.com":         true,
+}
+
+// idTokenVerifier verifies the Google-signed ID tokens callers attach to the authorization metadata of their requests.
+type idTokenVerifier struct {
+	audience      string
+	allowedEmails map[string]bool
+	validator     *idtoken.Validator
+}
+
+// newIDTokenVerifier creates an idTokenVerifier accepting tokens issued for audience.
+//
+// If allowedEmails is not empty only callers whose service account email is listed are permitted.
+// If jwks is not nil token signatures are checked against that JSON Web Key Set instead of Google's public keys,
+// so tokens can be verified offline.
+func newIDTokenVerifier(ctx context.Context, audience string, allowedEmails []string, jwks []byte) (*idTokenVerifier, error) {
+	// Google's certificates are public, don't let the validator look for credentials.
+	client := http.DefaultClient
+	if jwks != nil {
+		client = &http.Client{Transport: staticJWKS(jwks)}
+	}
+	validator, err := idtoken.NewValidator(ctx, idtoken.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("idtoken.NewValidator: %w", err)
+	}
+
+	v := &idTokenVerifier{
+		audience:  audience,
+		validator: validator,
+	}
+	if len(allowedEmails) > 0 {
+		v.allowedEmails = make(map[string]bool, len(allowedEmails))
+		for _, email := range allowedEmails {
+			v.allowedEmails[email] = true
+		}
+	}
+	return v, nil
+}
+
+// Verify verifies the ID token in the incoming metadata of ctx and returns the email of the caller.
+//
+// A missing or invalid token results in an Unauthenticated error, a caller outside the allowlist in a PermissionDenied error.
+func (v *idTokenVerifier) Verify(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+	token := strings.TrimPrefix(values[0], "Bearer ")
+	if token == values[0] {
+		return "", status.Error(codes.Unauthenticated, "authorization metadata is not a bearer token")
+	}
+
+	payload, err := v.validator.Validate(ctx, token, v.audience)
+	if err != nil {
+		return "", status.Errorf(codes.Unauthenticated, "invalid ID token: %v", err)
+	}
+	if !googleIssuers[payload.Issuer] {
+		return "", status.Errorf(codes.Unauthenticated, "invalid ID token: unexpected issuer %q", payload.Issuer)
+	}
+
+	email, _ := payload.Claims["email"].(string)
+	if verified, _ := payload.Claims["email_verified"].(bool); email == "" || !verified {
+		return "", status.Error(codes.Unauthenticated, "invalid ID token: no verified email claim")
+	}
+	if v.allowedEmails != nil && !v.allowedEmails[email] {
+		return "", status.Errorf(codes.PermissionDenied, "caller %q is not allowed", email)
+	}
+
+	return email, nil
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor that rejects Unary RPCs without a valid ID token.
+// Health checks are let through, probes do not carry tokens.
+func (v *idTokenVerifier) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, healthMethodPrefix) {
+			return handler(ctx, req)
+		}
+		email, err := v.Verify(ctx)
+		if err != nil {
+			zapcloudlogging.FromContext(ctx).Warn("rejected request", zap.String("method", info.FullMethod), zap.Error(err))
+			return nil, err
+		}
+
+		return handler(newCallerContext(ctx, email), req)
+	}
+}
+
+// StreamServerInterceptor is a gRPC server-side interceptor that rejects Streaming RPCs without a valid ID token.
+// Health Watch streams are let through, probes do not carry tokens.
+func (v *idTokenVerifier) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, healthMethodPrefix) {
+			return handler(srv, ss)
+		}
+		ctx := ss.Context()
+		email, err := v.Verify(ctx)
+		if err != nil {
+			zapcloudlogging.FromContext(ctx).Warn("rejected stream", zap.String("method", info.FullMethod), zap.Error(err))
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: newCallerContext(ctx, email)})
+	}
+}
+
+// ConnectInterceptor is a Connect handler interceptor that rejects RPCs without a valid ID token.
+func (v *idTokenVerifier) ConnectInterceptor() connect.Interceptor {
+	return connectInterceptorFunc(func(ctx context.Context, spec connect.Spec, header http.Header, call func(ctx context.Context) error) error {
+		email, err := v.Verify(ctx)
+		if err != nil {
+			zapcloudlogging.FromContext(ctx).Warn("rejected request", zap.String("procedure", spec.Procedure), zap.Error(err))
+			return connectError(err)
+		}
+
+		return call(newCallerContext(ctx, email))
+	})
+}
+
+type callerKey struct{}
+
+// newCallerContext returns a copy of ctx which carries the verified email of the caller,
+// in its request-scoped logger too.
+func newCallerContext(ctx context.Context, email string) context.Context {
+	ctx = withLogFields(ctx, zap.String("caller", email))
+	return context.WithValue(ctx, callerKey{}, email)
+}
+
+// callerFromContext returns the verified email of the caller, if any.
+func callerFromContext(ctx context.Context) (string, bool) {
+	email, ok := ctx.Value(callerKey{}).(string)
+	return email, ok
+}
+
+// staticJWKS is an http.RoundTripper answering every request with the same JSON Web Key Set.
+type staticJWKS []byte
+
+// RoundTrip implements http.RoundTripper.
+func (jwks staticJWKS) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(jwks)),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,472 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+)
+
+// breakerState is the state of a circuitBreaker.
+type breakerState int
+
+const (
+	// breakerClosed lets requests through, counting their failures.
+	breakerClosed breakerState = iota
+
+	// breakerHalfOpen lets a few probe requests through, and rejects the others.
+	breakerHalfOpen
+
+	// breakerOpen rejects requests until the cool-down period elapses.
+	breakerOpen
+)
+
+var breakerStateNames = map[breakerState]string{
+	breakerClosed:   "closed",
+	breakerHalfOpen: "half-open",
+	breakerOpen:     "open",
+}
+
+// String implements fmt.Stringer.
+func (s breakerState) String() string {
+	return breakerStateNames[s]
+}
+
+// circuitOpenReason is the reason of the ErrorInfo detail of the requests rejected by the circuit breaker.
+const circuitOpenReason = "CIRCUIT_OPEN"
+
+// halfOpenRetryDelay is the retry hint of the requests rejected while the probes of a half-open circuit are in flight.
+const halfOpenRetryDelay = time.Second
+
+// circuitBreaker stops sending requests to an upstream service while it fails, so relayed requests fail fast with
+// Unavailable instead of waiting out their timeout.
+//
+// The circuit opens after consecutiveFailures failures in a row, or when failureRatio of at least minRequests requests
+// fail within window. Requests are then rejected for coolDown, after which the circuit is half-open: halfOpenRequests
+// probes are let through, and close the circuit if they all succeed, or open it again as soon as one fails.
+//
+// Requests failing with Unavailable, DeadlineExceeded, Internal or Unknown are failures, canceled requests do not count.
+// Neither do requests which exceeded the deadline of their caller, see withCallerContext: a caller in a hurry would
+// otherwise open the circuit for everyone.
+type circuitBreaker struct {
+	// upstream is the name of the upstream service, labelling the logs and metrics.
+	upstream string
+
+	// consecutiveFailures and failureRatio do not open the circuit when zero.
+	consecutiveFailures int
+	failureRatio        float64
+	minRequests         int
+	window              time.Duration
+	coolDown            time.Duration
+	halfOpenRequests    int
+
+	mu    sync.Mutex
+	state breakerState
+
+	// generation identifies the current state, so the outcome of a request started in an earlier state is ignored.
+	generation int
+
+	// consecutive, requests and failures count the requests in the closed state, since windowStart for the latter.
+	consecutive int
+	requests    int
+	failures    int
+	windowStart time.Time
+
+	// probes counts the requests in flight in the half-open state, successes the probes which succeeded.
+	probes    int
+	successes int
+
+	// retryAt is the end of the cool-down of an open circuit.
+	retryAt time.Time
+
+	listeners []func(state breakerState)
+
+	stateDesc   *prometheus.Desc
+	transitions *prometheus.CounterVec
+	rejected    prometheus.Counter
+}
+
+var _ prometheus.Collector = (*circuitBreaker)(nil)
+
+func defaultCircuitBreaker(upstream string) *circuitBreaker {
+	labels := prometheus.Labels{"upstream": upstream}
+	return &circuitBreaker{
+		upstream:            upstream,
+		consecutiveFailures: 5,
+		failureRatio:        0.5,
+		minRequests:         10,
+		window:              time.Minute,
+		coolDown:            10 * time.Second,
+		halfOpenRequests:    1,
+		windowStart:         time.Now(),
+		stateDesc: prometheus.NewDesc(metricsNamespace+"_upstream_circuit_state",
+			"State of the circuit breaker of the upstream requests, 1 for the current state.", []string{"state"}, labels),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   "upstream",
+			Name:        "circuit_transitions_total",
+			Help:        "State changes of the circuit breaker of the upstream requests, by new state.",
+			ConstLabels: labels,
+		}, []string{"state"}),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   "upstream",
+			Name:        "circuit_rejected_total",
+			Help:        "Upstream requests rejected by the circuit breaker.",
+			ConstLabels: labels,
+		}),
+	}
+}
+
+// circuitBreakerFromEnv returns the default circuit breaker of upstream, overridden by the GRPC_PING_BREAKER_*
+// environment variables.
+func circuitBreakerFromEnv(upstream string) (*circuitBreaker, error) {
+	b := defaultCircuitBreaker(upstream)
+
+	counts := []struct {
+		env string
+		n   *int
+		min int
+	}{
+		{"GRPC_PING_BREAKER_CONSECUTIVE_FAILURES", &b.consecutiveFailures, 0},
+		{"GRPC_PING_BREAKER_MIN_REQUESTS", &b.minRequests, 1},
+		{"GRPC_PING_BREAKER_HALF_OPEN_REQUESTS", &b.halfOpenRequests, 1},
+	}
+	for _, c := range counts {
+		if v := os.Getenv(c.env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < c.min {
+				return nil, fmt.Errorf("invalid %s %q: must be a number >= %d", c.env, v, c.min)
+			}
+			*c.n = n
+		}
+	}
+	if v := os.Getenv("GRPC_PING_BREAKER_FAILURE_RATIO"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil, fmt.Errorf("invalid GRPC_PING_BREAKER_FAILURE_RATIO %q: must be a number between 0 and 1", v)
+		}
+		b.failureRatio = f
+	}
+	durations := []struct {
+		env string
+		d   *time.Duration
+	}{
+		{"GRPC_PING_BREAKER_WINDOW", &b.window},
+		{"GRPC_PING_BREAKER_COOL_DOWN", &b.coolDown},
+	}
+	for _, d := range durations {
+		if v := os.Getenv(d.env); v != "" {
+			var err error
+			if *d.d, err = time.ParseDuration(v); err != nil || *d.d <= 0 {
+				return nil, fmt.Errorf("invalid %s %q: must be a positive duration", d.env, v)
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (b *circuitBreaker) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("consecutive_failures", b.consecutiveFailures)
+	enc.AddFloat64("failure_ratio", b.failureRatio)
+	enc.AddInt("min_requests", b.minRequests)
+	enc.AddDuration("window", b.window)
+	enc.AddDuration("cool_down", b.coolDown)
+	enc.AddInt("half_open_requests", b.halfOpenRequests)
+	return nil
+}
+
+// OnStateChange registers f to be called with the new state on every state change. f is called with the lock of b
+// held and must not block.
+func (b *circuitBreaker) OnStateChange(f func(state breakerState)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.listeners = append(b.listeners, f)
+	f(b.state)
+}
+
+// DialOptions returns the options installing the circuit breaker on the connection to the upstream service.
+func (b *circuitBreaker) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(b.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(b.StreamClientInterceptor()),
+	}
+}
+
+// UnaryClientInterceptor is a gRPC client-side interceptor that rejects Unary RPCs while the circuit is open.
+func (b *circuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, err := b.allow()
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(breakerCode(ctx, err))
+
+		return err
+	}
+}
+
+// StreamClientInterceptor is a gRPC client-side interceptor that rejects Streaming RPCs while the circuit is open.
+// The outcome of a stream is known once it receives its first message, so long-lived streams do not hold the probes
+// of a half-open circuit.
+func (b *circuitBreaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done, err := b.allow()
+		if err != nil {
+			return nil, err
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			done(breakerCode(ctx, err))
+			return nil, err
+		}
+
+		s := &breakerStream{ClientStream: cs, ctx: ctx, done: done}
+		go func() {
+			<-ctx.Done()
+			s.finish(breakerCode(ctx, status.FromContextError(ctx.Err()).Err()))
+		}()
+		return s, nil
+	}
+}
+
+// breakerStream wraps grpc.ClientStream to report the outcome of the stream to the circuit breaker.
+type breakerStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	once sync.Once
+	done func(code codes.Code)
+}
+
+// RecvMsg implements grpc.ClientStream.
+func (s *breakerStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil || err == io.EOF {
+		s.finish(codes.OK)
+	} else {
+		s.finish(breakerCode(s.ctx, err))
+	}
+	return err
+}
+
+func (s *breakerStream) finish(code codes.Code) {
+	s.once.Do(func() {
+		s.done(code)
+	})
+}
+
+// allow returns the function reporting the outcome of a request, or the error rejecting it if the circuit is open.
+func (b *circuitBreaker) allow() (done func(code codes.Code), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		b.rejected.Inc()
+		return nil, circuitOpenError(time.Until(b.retryAt))
+	case breakerHalfOpen:
+		if b.probes >= b.halfOpenRequests {
+			b.rejected.Inc()
+			return nil, circuitOpenError(halfOpenRetryDelay)
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(code codes.Code) { b.done(generation, code) }, nil
+}
+
+// done records the outcome of a request allowed in generation.
+func (b *circuitBreaker) done(generation int, code codes.Code) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case breakerClosed:
+		if code == codes.Canceled {
+			return
+		}
+		if now := time.Now(); now.Sub(b.windowStart) > b.window {
+			b.requests, b.failures, b.windowStart = 0, 0, now
+		}
+		b.requests++
+		if !isBreakerFailure(code) {
+			b.consecutive = 0
+			return
+		}
+		b.failures++
+		b.consecutive++
+
+		if b.consecutiveFailures > 0 && b.consecutive >= b.consecutiveFailures {
+			b.setState(breakerOpen, zap.Int("consecutive_failures", b.consecutive), zap.Stringer("code", code))
+		} else if b.failureRatio > 0 && b.requests >= b.minRequests && float64(b.failures) >= b.failureRatio*float64(b.requests) {
+			b.setState(breakerOpen, zap.Int("requests", b.requests), zap.Int("failures", b.failures), zap.Stringer("code", code))
+		}
+	case breakerHalfOpen:
+		b.probes--
+		switch {
+		case code == codes.Canceled:
+		case isBreakerFailure(code):
+			b.setState(breakerOpen, zap.String("probe", "failed"), zap.Stringer("code", code))
+		default:
+			b.successes++
+			if b.successes >= b.halfOpenRequests {
+				b.setState(breakerClosed, zap.Int("probes", b.successes))
+			}
+		}
+	}
+}
+
+// halfOpen ends the cool-down of the open circuit of generation. It does nothing if the state changed since.
+func (b *circuitBreaker) halfOpen(generation int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	b.setState(breakerHalfOpen)
+}
+
+// setState changes the state of b to state, logging fields with the change. b.mu must be held.
+func (b *circuitBreaker) setState(state breakerState, fields ...zap.Field) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.consecutive, b.requests, b.failures, b.windowStart = 0, 0, 0, time.Now()
+	b.probes, b.successes = 0, 0
+
+	fields = append([]zap.Field{zap.String("upstream", b.upstream), zap.Stringer("from", from), zap.Stringer("to", state)}, fields...)
+	if state == breakerOpen {
+		generation := b.generation
+		b.retryAt = time.Now().Add(b.coolDown)
+		time.AfterFunc(b.coolDown, func() { b.halfOpen(generation) })
+		logger.Warn("upstream circuit opened", append(fields, zap.Duration("cool_down", b.coolDown))...)
+	} else {
+		logger.Info("upstream circuit state changed", fields...)
+	}
+
+	b.transitions.WithLabelValues(state.String()).Inc()
+	for _, f := range b.listeners {
+		f(state)
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (b *circuitBreaker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- b.stateDesc
+	b.transitions.Describe(ch)
+	b.rejected.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (b *circuitBreaker) Collect(ch chan<- prometheus.Metric) {
+	b.mu.Lock()
+	current := b.state
+	b.mu.Unlock()
+
+	for _, state := range []breakerState{breakerClosed, breakerHalfOpen, breakerOpen} {
+		v := 0.0
+		if state == current {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(b.stateDesc, prometheus.GaugeValue, v, state.String())
+	}
+	b.transitions.Collect(ch)
+	b.rejected.Collect(ch)
+}
+
+type callerContextKey struct{}
+
+// withCallerContext returns a copy of ctx remembering it as the context of the caller of the upstream requests made
+// with it, before the relay sets its own timeouts. The circuit breaker does not count the requests which exceeded the
+// deadline of the caller.
+func withCallerContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, ctx)
+}
+
+// breakerCode returns the code of a request made with ctx failing with err, as the circuit breaker counts it.
+// DeadlineExceeded is reported as Canceled when the deadline of the caller expired: only the timeouts of the relay,
+// and the DeadlineExceeded errors returned by the upstream service while the caller waits, are failures.
+func breakerCode(ctx context.Context, err error) codes.Code {
+	code := status.Code(err)
+	if code != codes.DeadlineExceeded {
+		return code
+	}
+	if caller, ok := ctx.Value(callerContextKey{}).(context.Context); ok && caller.Err() == context.DeadlineExceeded {
+		return codes.Canceled
+	}
+	return code
+}
+
+// isBreakerFailure reports whether a request failing with code counts as a failure of the upstream service.
+func isBreakerFailure(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// circuitOpenError returns the Unavailable error of a request rejected by the circuit breaker, with a RetryInfo
+// detail hinting when to retry, after retryAfter.
+func circuitOpenError(retryAfter time.Duration) error {
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	st := status.Newf(codes.Unavailable, "circuit breaker is open, retry after %s", retryAfter.Round(time.Millisecond))
+	st, err := st.WithDetails(
+		&errdetails.ErrorInfo{Reason: circuitOpenReason, Domain: pb.PingService_ServiceDesc.ServiceName},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "circuit breaker is open, retry after %s", retryAfter.Round(time.Millisecond))
+	}
+	return st.Err()
+}
+
+// isCircuitOpen reports whether err rejected a request because a circuit breaker is open, here or upstream.
+func isCircuitOpen(err error) bool {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.GetReason() == circuitOpenReason {
+			return true
+		}
+	}
+	return false
+}
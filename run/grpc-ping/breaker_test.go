@@ -0,0 +1,200 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestCircuitBreaker returns the default circuit breaker with a short cool-down.
+func newTestCircuitBreaker(t *testing.T) *circuitBreaker {
+	t.Helper()
+
+	b := defaultCircuitBreaker("test")
+	b.coolDown = 10 * time.Millisecond
+	return b
+}
+
+func (b *circuitBreaker) currentState() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// request sends a request through b failing with code, and reports whether b let it through.
+func (b *circuitBreaker) request(code codes.Code) bool {
+	done, err := b.allow()
+	if err != nil {
+		return false
+	}
+	done(code)
+	return true
+}
+
+// open opens the circuit of b with consecutive failures.
+func (b *circuitBreaker) open(t *testing.T) {
+	t.Helper()
+
+	for i := 0; i < b.consecutiveFailures; i++ {
+		b.request(codes.Unavailable)
+	}
+	if got := b.currentState(); got != breakerOpen {
+		t.Fatalf("state = %v after %d failures, want open", got, b.consecutiveFailures)
+	}
+}
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	b := newTestCircuitBreaker(t)
+	b.coolDown = time.Hour
+	b.consecutiveFailures = 3
+	b.failureRatio = 0
+
+	// Successes and errors of the caller reset the count, canceled requests do not count.
+	for _, code := range []codes.Code{codes.Unavailable, codes.Unavailable, codes.OK, codes.Unavailable, codes.NotFound, codes.Unavailable, codes.Canceled} {
+		b.request(code)
+	}
+	if got := b.currentState(); got != breakerClosed {
+		t.Fatalf("state = %v, want closed", got)
+	}
+	b.request(codes.DeadlineExceeded)
+	if got := b.currentState(); got != breakerClosed {
+		t.Fatalf("state = %v after 2 failures in a row, want closed", got)
+	}
+	b.request(codes.Internal)
+	if got := b.currentState(); got != breakerOpen {
+		t.Fatalf("state = %v after 3 failures in a row, want open", got)
+	}
+
+	_, err := b.allow()
+	if !isCircuitOpen(err) || status.Code(err) != codes.Unavailable {
+		t.Errorf("allow() = %v, want a CIRCUIT_OPEN Unavailable error", err)
+	}
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	b := newTestCircuitBreaker(t)
+	b.coolDown = time.Hour
+	b.consecutiveFailures = 0
+	b.failureRatio = 0.5
+	b.minRequests = 4
+
+	for _, code := range []codes.Code{codes.OK, codes.Unavailable, codes.OK} {
+		b.request(code)
+	}
+	if got := b.currentState(); got != breakerClosed {
+		t.Fatalf("state = %v before %d requests, want closed", got, b.minRequests)
+	}
+	b.request(codes.Unavailable)
+	if got := b.currentState(); got != breakerOpen {
+		t.Fatalf("state = %v after 2 failures out of %d requests, want open", got, b.minRequests)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe codes.Code
+		want  breakerState
+	}{
+		{"probe succeeds", codes.OK, breakerClosed},
+		{"probe fails", codes.Unavailable, breakerOpen},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestCircuitBreaker(t)
+			b.open(t)
+			waitFor(t, func() bool { return b.currentState() == breakerHalfOpen })
+
+			done, err := b.allow()
+			if err != nil {
+				t.Fatalf("allow() of the probe = %v", err)
+			}
+			// Requests beyond the probes are rejected while they are in flight.
+			if _, err := b.allow(); !isCircuitOpen(err) {
+				t.Errorf("allow() while the probe is in flight = %v, want a CIRCUIT_OPEN error", err)
+			}
+
+			done(tt.probe)
+			if got := b.currentState(); got != tt.want {
+				t.Errorf("state = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresStaleOutcomes(t *testing.T) {
+	b := newTestCircuitBreaker(t)
+
+	// A request allowed while closed answers after the circuit opened and became half-open.
+	stale, err := b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.open(t)
+	waitFor(t, func() bool { return b.currentState() == breakerHalfOpen })
+
+	stale(codes.OK)
+	if got := b.currentState(); got != breakerHalfOpen {
+		t.Errorf("state = %v after an outcome of the closed circuit, want half-open", got)
+	}
+	stale(codes.Unavailable)
+	if got := b.currentState(); got != breakerHalfOpen {
+		t.Errorf("state = %v after an outcome of the closed circuit, want half-open", got)
+	}
+	if !b.request(codes.OK) {
+		t.Error("probe rejected after an outcome of the closed circuit")
+	}
+}
+
+func TestCircuitBreakerCallerDeadline(t *testing.T) {
+	deadlineExceeded := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	}
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want breakerState
+	}{
+		{"caller deadline", withCallerContext(expired), breakerClosed},
+		{"relay timeout", withCallerContext(context.Background()), breakerOpen},
+		{"no caller", context.Background(), breakerOpen},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestCircuitBreaker(t)
+			b.coolDown = time.Hour
+			b.consecutiveFailures = 1
+
+			interceptor := b.UnaryClientInterceptor()
+			if err := interceptor(tt.ctx, "/ping.PingService/Send", nil, nil, nil, deadlineExceeded); status.Code(err) != codes.DeadlineExceeded {
+				t.Fatalf("interceptor() = %v, want DeadlineExceeded", err)
+			}
+			if got := b.currentState(); got != tt.want {
+				t.Errorf("state = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+)
+
+// broadcastTimeout is the deadline of the requests relayed by Broadcast, like PingRequest's.
+const broadcastTimeout = 30 * time.Second
+
+// Broadcast relays req to every upstream service at once and reports the result of each, see pb.BroadcastMode.
+//
+// Each upstream service gets a single attempt, retries and hedging would hide the failures Broadcast reports, but
+// its circuit breaker applies. Only the connection of the primary upstream service has the retry policy of
+// retryModeServiceConfig, which gRPC applies to its attempt too. When the mode is not satisfied, the error carries
+// the BroadcastResponse as a detail.
+func (s *pingService) Broadcast(ctx context.Context, req *pb.BroadcastRequest) (*pb.BroadcastResponse, error) {
+	logger := zapcloudlogging.FromContext(ctx)
+
+	if len(upstreams) == 0 {
+		return nil, errNoUpstream
+	}
+	needed, err := broadcastNeeded(req.GetMode(), int(req.GetQuorum()), len(upstreams))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(withCallerContext(ctx), broadcastTimeout)
+	defer cancel()
+	ctx = withOutgoingCloudTraceContext(ctx)
+
+	p := &pb.Request{
+		Message: relayedMessage(req.GetMessage()),
+	}
+	results := make([]*pb.UpstreamResult, len(upstreams))
+	done := make(chan error, len(upstreams))
+	for i, u := range upstreams {
+		i, u := i, u
+		go func() {
+			start := time.Now()
+			resp, err := u.ping(ctx, p)
+			results[i] = newUpstreamResult(u, resp, err, time.Since(start))
+			if err != nil && status.Code(err) != codes.Canceled {
+				logger.Warn("broadcast to upstream failed", zap.String("upstream", u.name), zap.Error(err))
+			}
+			done <- err
+		}()
+	}
+
+	var succeeded, failed int
+	for range upstreams {
+		if err := <-done; err != nil {
+			failed++
+		} else {
+			succeeded++
+		}
+		// Cancel the upstream services still in flight once the outcome is known, they report CANCELLED.
+		if needed > 0 && (succeeded >= needed || failed > len(upstreams)-needed) {
+			cancel()
+		}
+	}
+
+	resp := &pb.BroadcastResponse{
+		Results:   results,
+		Succeeded: int32(succeeded),
+		ServedBy:  s.info,
+	}
+	logger.Info("broadcast finished", zap.Stringer("mode", req.GetMode()), zap.Int("upstreams", len(upstreams)),
+		zap.Int("succeeded", succeeded), zap.Int("needed", needed))
+	if succeeded < needed {
+		st := status.Newf(codes.Unavailable, "%d of %d upstream services succeeded, %d needed: %s",
+			succeeded, len(upstreams), needed, summarizeResults(results))
+		if withResp, err := st.WithDetails(resp); err == nil {
+			st = withResp
+		}
+		return nil, st.Err()
+	}
+
+	return resp, nil
+}
+
+// broadcastNeeded returns the number of the n upstream services which must succeed in mode, 0 to wait for all of them
+// whatever their results.
+func broadcastNeeded(mode pb.BroadcastMode, quorum, n int) (int, error) {
+	switch mode {
+	case pb.BroadcastMode_BROADCAST_MODE_ALL:
+		return 0, nil
+	case pb.BroadcastMode_BROADCAST_MODE_FIRST:
+		return 1, nil
+	case pb.BroadcastMode_BROADCAST_MODE_QUORUM:
+		if quorum == 0 {
+			return n/2 + 1, nil
+		}
+		if quorum < 0 || quorum > n {
+			return 0, status.Errorf(codes.InvalidArgument, "quorum must be between 1 and the %d upstream services: %d", n, quorum)
+		}
+		return quorum, nil
+	}
+	return 0, status.Errorf(codes.InvalidArgument, "unknown broadcast mode: %v", mode)
+}
+
+func newUpstreamResult(u *upstream, resp *pb.Response, err error, latency time.Duration) *pb.UpstreamResult {
+	st := status.Convert(err)
+	return &pb.UpstreamResult{
+		Name:     u.name,
+		Host:     u.host,
+		Response: resp,
+		Code:     canonicalCodeNames[st.Code()],
+		Error:    st.Message(),
+		Latency:  durationpb.New(latency),
+	}
+}
+
+// summarizeResults returns the name and code of each upstream service of results, e.g. "us: OK, eu: UNAVAILABLE".
+func summarizeResults(results []*pb.UpstreamResult) string {
+	summary := make([]string, 0, len(results))
+	for _, r := range results {
+		summary = append(summary, fmt.Sprintf("%s: %s", r.GetName(), r.GetCode()))
+	}
+	return strings.Join(summary, ", ")
+}
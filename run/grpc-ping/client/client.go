@@ -19,12 +19,20 @@ import (
 	"context"
 	"crypto/tls"
 	"flag"
+	"io"
 	"log"
+	"math"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
 )
@@ -37,12 +45,33 @@ var (
 	skipVerify   = flag.Bool("skip-verify", false, "Skip server hostname verification in SSL validation [false]")
 	message      = flag.String("message", "Hi there", "The body of the content sent to server")
 	sendUpstream = flag.Bool("relay", false, "Direct ping to relay the request to a ping-upstream service [false]")
+	subscribe    = flag.Int("subscribe", 0, "Number of pongs to receive over a server stream instead of a unary Send [0]")
+	pingPong     = flag.Int("pingpong", 0, "Number of pings to exchange over a bidirectional stream instead of a unary Send [0]")
+	batch        = flag.Int("batch", 0, "Number of pings to send over a client stream instead of a unary Send [0]")
+	interval     = flag.Duration("interval", time.Second, "Interval between streamed pings or pongs [1s]")
+	serverInfo   = flag.Bool("info", false, "Print the identity of the server instead of sending a ping [false]")
+	broadcast    = flag.String("broadcast", "", "Broadcast the ping to every upstream service of the server: all, first or quorum")
+	quorum       = flag.Int("quorum", 0, "Upstream services which must succeed with -broadcast=quorum [a majority]")
+	list         = flag.Bool("list", false, "List the services and methods of the server using server reflection [false]")
+	invokeMethod = flag.String("invoke", "", "Call any method, e.g. ping.PingService/Send, using server reflection")
+	data         = flag.String("data", "{}", "JSON request body of -invoke, a JSON array of requests for client-streaming methods")
+	timeout      = flag.Duration("timeout", 0, "Deadline of the whole RPC [120s plus the time needed to stream all messages]")
+	traceExp     = flag.String("trace-exporter", "", "Export OpenTelemetry spans: otlp, stdout or file [disabled]")
+	traceFile    = flag.String("trace-file", "traces.json", "File the spans are appended to with -trace-exporter=file")
 )
 
 func main() {
 	flag.Parse()
 
-	var opts []grpc.DialOption
+	ctx := context.Background()
+	if err := setupTracing(ctx, *traceExp, *traceFile); err != nil {
+		logger.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	}
 	if *serverHost != "" {
 		opts = append(opts, grpc.WithAuthority(*serverHost))
 	}
@@ -61,11 +90,46 @@ func main() {
 	}
 	defer conn.Close()
 	client := pb.NewPingServiceClient(conn)
-	send(client)
+	ctx = startRootSpan(ctx, "grpc-ping-client")
+	switch {
+	case *list:
+		ctx, cancel := context.WithTimeout(ctx, rpcTimeout(0))
+		defer cancel()
+		if err := listServices(ctx, conn); err != nil {
+			fatalf("Error while listing services: %v", err)
+		}
+	case *invokeMethod != "":
+		ctx, cancel := context.WithTimeout(ctx, rpcTimeout(0))
+		defer cancel()
+		if err := invoke(ctx, conn, *invokeMethod, *data); err != nil {
+			fatalf("Error while invoking %s: %v", *invokeMethod, err)
+		}
+	case *serverInfo:
+		getServerInfo(ctx, client)
+	case *broadcast != "":
+		broadcastPing(ctx, client)
+	case *subscribe > 0:
+		subscribeStream(ctx, client)
+	case *pingPong > 0:
+		pingPongStream(ctx, client)
+	case *batch > 0:
+		sendBatchStream(ctx, client)
+	default:
+		send(ctx, client)
+	}
+	endTracing(nil)
 }
 
-func send(client pb.PingServiceClient) {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+// rpcTimeout returns the deadline of an RPC streaming n messages -interval apart.
+func rpcTimeout(n int) time.Duration {
+	if *timeout > 0 {
+		return *timeout
+	}
+	return 120*time.Second + time.Duration(n)*(*interval)
+}
+
+func send(ctx context.Context, client pb.PingServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout(0))
 	defer cancel()
 
 	var resp *pb.Response
@@ -81,7 +145,7 @@ func send(client pb.PingServiceClient) {
 	}
 
 	if err != nil {
-		logger.Fatalf("Error while executing Send: %v", err)
+		fatalf("Error while executing Send: %v", err)
 	}
 
 	respMessage := resp.Pong.GetMessage()
@@ -89,4 +153,234 @@ func send(client pb.PingServiceClient) {
 	logger.Println("Unary Request/Unary Response")
 	logger.Printf("  Sent Ping: %s", *message)
 	logger.Printf("  Received:\n    Pong: %s\n    Server Time: %s", respMessage, timestamp)
+	printHops(resp.GetHops())
+}
+
+func getServerInfo(ctx context.Context, client pb.PingServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout(0))
+	defer cancel()
+
+	resp, err := client.ServerInfo(ctx, &pb.ServerInfoRequest{})
+	if err != nil {
+		fatalf("Error while executing ServerInfo: %v", err)
+	}
+
+	info := resp.GetServerInfo()
+	logger.Println("Server Info")
+	logger.Printf("  Project: %s (%s)", info.GetProjectId(), info.GetNumericProjectId())
+	logger.Printf("  Region: %s", info.GetRegion())
+	logger.Printf("  Service: %s\n  Revision: %s\n  Configuration: %s", info.GetService(), info.GetRevision(), info.GetConfiguration())
+	logger.Printf("  Instance: %s", info.GetInstanceId())
+	logger.Printf("  Service Account: %s", info.GetServiceAccountEmail())
+}
+
+func broadcastPing(ctx context.Context, client pb.PingServiceClient) {
+	mode, ok := pb.BroadcastMode_value["BROADCAST_MODE_"+strings.ToUpper(*broadcast)]
+	if !ok {
+		fatalf("Invalid -broadcast %q: must be all, first or quorum", *broadcast)
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout(0))
+	defer cancel()
+
+	resp, err := client.Broadcast(ctx, &pb.BroadcastRequest{
+		Message: *message,
+		Mode:    pb.BroadcastMode(mode),
+		Quorum:  int32(*quorum),
+	})
+	if err != nil {
+		// The results are attached to the error when the mode is not satisfied.
+		for _, d := range status.Convert(err).Details() {
+			if r, ok := d.(*pb.BroadcastResponse); ok {
+				printBroadcastResults(r)
+			}
+		}
+		fatalf("Error while executing Broadcast: %v", err)
+	}
+
+	logger.Println("Unary Request/Broadcast Response")
+	logger.Printf("  Sent Ping: %s", *message)
+	printBroadcastResults(resp)
+}
+
+// printBroadcastResults prints the result of each upstream service of a Broadcast.
+func printBroadcastResults(resp *pb.BroadcastResponse) {
+	logger.Printf("  Succeeded: %d of %d", resp.GetSucceeded(), len(resp.GetResults()))
+	for _, r := range resp.GetResults() {
+		logger.Printf("  %s (%s): %s in %s", r.GetName(), r.GetHost(), r.GetCode(), r.GetLatency().AsDuration())
+		if r.GetError() != "" {
+			logger.Printf("    Error: %s", r.GetError())
+			continue
+		}
+		logger.Printf("    Pong: %s", r.GetResponse().GetPong().GetMessage())
+		printHops(r.GetResponse().GetHops())
+	}
+}
+
+// printHops prints the servers a response passed through, starting with the one which produced it.
+func printHops(hops []*pb.ServerInfo) {
+	if len(hops) == 0 {
+		return
+	}
+
+	logger.Println("    Hops:")
+	for i, hop := range hops {
+		logger.Printf("      %d. %s (%s) instance %s", i+1, hop.GetRevision(), hop.GetRegion(), hop.GetInstanceId())
+	}
+}
+
+func subscribeStream(ctx context.Context, client pb.PingServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout(*subscribe))
+	defer cancel()
+
+	req := &pb.SubscribeRequest{
+		Message:  *message,
+		Count:    int32(*subscribe),
+		Interval: durationpb.New(*interval),
+	}
+	var stream pb.PingService_SubscribeClient
+	var err error
+	if *sendUpstream {
+		stream, err = client.SubscribeUpstream(ctx, req)
+	} else {
+		stream, err = client.Subscribe(ctx, req)
+	}
+	if err != nil {
+		fatalf("Error while executing Subscribe: %v", err)
+	}
+
+	logger.Println("Unary Request/Stream Response")
+	logger.Printf("  Sent Ping: %s", *message)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fatalf("Error while receiving from Subscribe: %v", err)
+		}
+
+		logger.Printf("  Received:\n    Pong %d: %s\n    Server Time: %s", resp.Pong.GetIndex(), resp.Pong.GetMessage(), resp.Pong.GetReceivedOn().AsTime())
+	}
+}
+
+func pingPongStream(ctx context.Context, client pb.PingServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout(*pingPong))
+	defer cancel()
+
+	var stream pb.PingService_PingPongClient
+	var err error
+	if *sendUpstream {
+		stream, err = client.PingPongUpstream(ctx)
+	} else {
+		stream, err = client.PingPong(ctx)
+	}
+	if err != nil {
+		fatalf("Error while executing PingPong: %v", err)
+	}
+
+	// sentAt holds the send time of each ping, the server answers them in order with Pong.Index starting at 1.
+	sentAt := make([]time.Time, *pingPong)
+	var mu sync.Mutex
+	sendErr := make(chan error, 1)
+	go func() {
+		for i := range sentAt {
+			if i > 0 && *interval > 0 {
+				time.Sleep(*interval)
+			}
+			mu.Lock()
+			sentAt[i] = time.Now()
+			mu.Unlock()
+			if err := stream.Send(&pb.Request{Message: *message}); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- stream.CloseSend()
+	}()
+
+	logger.Println("Stream Request/Stream Response")
+	logger.Printf("  Sent Ping: %s", *message)
+	rtts := make([]time.Duration, 0, *pingPong)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fatalf("Error while receiving from PingPong: %v", err)
+		}
+		index := int(resp.Pong.GetIndex())
+		if index < 1 || index > len(sentAt) {
+			fatalf("Received unexpected Pong index %d", index)
+		}
+
+		mu.Lock()
+		rtt := time.Since(sentAt[index-1])
+		mu.Unlock()
+		rtts = append(rtts, rtt)
+		logger.Printf("  Received:\n    Pong %d: %s\n    Server Time: %s\n    RTT: %s", index, resp.Pong.GetMessage(), resp.Pong.GetReceivedOn().AsTime(), rtt)
+	}
+	if err := <-sendErr; err != nil {
+		fatalf("Error while sending to PingPong: %v", err)
+	}
+
+	printRTTSummary(rtts)
+}
+
+func sendBatchStream(ctx context.Context, client pb.PingServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout(*batch))
+	defer cancel()
+
+	var stream pb.PingService_SendBatchClient
+	var err error
+	if *sendUpstream {
+		stream, err = client.SendBatchUpstream(ctx)
+	} else {
+		stream, err = client.SendBatch(ctx)
+	}
+	if err != nil {
+		fatalf("Error while executing SendBatch: %v", err)
+	}
+
+	logger.Println("Stream Request/Unary Response")
+	for i := 0; i < *batch; i++ {
+		if i > 0 && *interval > 0 {
+			time.Sleep(*interval)
+		}
+		// Send returns io.EOF once the server ended the stream, the actual status is reported by CloseAndRecv.
+		if err := stream.Send(&pb.Request{Message: *message}); err != nil {
+			if err == io.EOF {
+				break
+			}
+			fatalf("Error while sending to SendBatch: %v", err)
+		}
+	}
+	logger.Printf("  Sent Pings: %d x %s", *batch, *message)
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		fatalf("Error while executing SendBatch: %v", err)
+	}
+
+	logger.Printf("  Received:\n    Count: %d\n    Total Bytes: %d\n    First Received: %s\n    Last Received: %s\n    Message: %s",
+		resp.GetCount(), resp.GetTotalBytes(), resp.GetFirstReceivedOn().AsTime(), resp.GetLastReceivedOn().AsTime(), resp.GetMessage())
+	printHops(resp.GetHops())
+}
+
+// printRTTSummary prints the min/avg/max/p99 round-trip times of rtts.
+func printRTTSummary(rtts []time.Duration) {
+	if len(rtts) == 0 {
+		return
+	}
+
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	var total time.Duration
+	for _, rtt := range rtts {
+		total += rtt
+	}
+	// Nearest-rank percentile.
+	p99 := rtts[int(math.Ceil(0.99*float64(len(rtts))))-1]
+
+	logger.Printf("RTT summary (%d pongs):", len(rtts))
+	logger.Printf("  min: %s\n  avg: %s\n  max: %s\n  p99: %s", rtts[0], total/time.Duration(len(rtts)), rtts[len(rtts)-1], p99)
 }
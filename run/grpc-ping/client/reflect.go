@@ -0,0 +1,250 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// reflectionClient resolves the services of a server through the gRPC server reflection service,
+// so methods can be called without their proto files.
+type reflectionClient struct {
+	stream rpb.ServerReflection_ServerReflectionInfoClient
+
+	// files holds every file descriptor received so far. The server sends each file at most once per stream.
+	files map[string]*descriptorpb.FileDescriptorProto
+}
+
+func newReflectionClient(ctx context.Context, conn *grpc.ClientConn) (*reflectionClient, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reflectionClient{
+		stream: stream,
+		files:  make(map[string]*descriptorpb.FileDescriptorProto),
+	}, nil
+}
+
+// Close closes the reflection stream.
+func (c *reflectionClient) Close() error {
+	return c.stream.CloseSend()
+}
+
+func (c *reflectionClient) request(req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := c.stream.Send(req); err != nil {
+		return nil, err
+	}
+	resp, err := c.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, fmt.Errorf("reflection error %d: %s", errResp.GetErrorCode(), errResp.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+// ListServices returns the full names of the services of the server.
+func (c *reflectionClient) ListServices() ([]string, error) {
+	resp, err := c.request(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var services []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		services = append(services, svc.GetName())
+	}
+	return services, nil
+}
+
+// ResolveService returns the descriptor of the service named name.
+func (c *reflectionClient) ResolveService(name string) (protoreflect.ServiceDescriptor, error) {
+	resp, err := c.request(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: name,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(b, fd); err != nil {
+			return nil, err
+		}
+		c.files[fd.GetName()] = fd
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range c.files {
+		set.File = append(set.File, fd)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, err
+	}
+	svc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", name)
+	}
+	return svc, nil
+}
+
+// ResolveMethod returns the descriptor of the method named name, of the form package.Service/Method or package.Service.Method.
+func (c *reflectionClient) ResolveMethod(name string) (protoreflect.MethodDescriptor, error) {
+	name = strings.TrimPrefix(name, "/")
+	i := strings.LastIndexAny(name, "/.")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid method name %q: must be of the form package.Service/Method", name)
+	}
+
+	svc, err := c.ResolveService(name[:i])
+	if err != nil {
+		return nil, err
+	}
+	method := svc.Methods().ByName(protoreflect.Name(name[i+1:]))
+	if method == nil {
+		return nil, fmt.Errorf("service %s has no method %s", svc.FullName(), name[i+1:])
+	}
+	return method, nil
+}
+
+// listServices prints the services of the server and their methods.
+func listServices(ctx context.Context, conn *grpc.ClientConn) error {
+	rc, err := newReflectionClient(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	services, err := rc.ListServices()
+	if err != nil {
+		return err
+	}
+	for _, name := range services {
+		svc, err := rc.ResolveService(name)
+		if err != nil {
+			return err
+		}
+
+		logger.Println(svc.FullName())
+		methods := svc.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			m := methods.Get(i)
+			logger.Printf("  rpc %s(%s%s) returns (%s%s)", m.Name(), streamPrefix(m.IsStreamingClient()), m.Input().FullName(), streamPrefix(m.IsStreamingServer()), m.Output().FullName())
+		}
+	}
+	return nil
+}
+
+func streamPrefix(streaming bool) string {
+	if streaming {
+		return "stream "
+	}
+	return ""
+}
+
+// invoke calls the method named name with the JSON request body data and prints the responses as JSON.
+//
+// Client-streaming methods take a JSON array of requests, which are sent one after the other.
+func invoke(ctx context.Context, conn *grpc.ClientConn, name, data string) error {
+	rc, err := newReflectionClient(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	method, err := rc.ResolveMethod(name)
+	if err != nil {
+		return err
+	}
+
+	var bodies []json.RawMessage
+	if method.IsStreamingClient() {
+		if err := json.Unmarshal([]byte(data), &bodies); err != nil {
+			return fmt.Errorf("%s is client-streaming, the request body must be a JSON array: %w", method.FullName(), err)
+		}
+	} else {
+		bodies = []json.RawMessage{json.RawMessage(data)}
+	}
+
+	var reqs []proto.Message
+	for _, body := range bodies {
+		req := dynamicpb.NewMessage(method.Input())
+		if err := protojson.Unmarshal(body, req); err != nil {
+			return fmt.Errorf("invalid %s: %w", method.Input().FullName(), err)
+		}
+		reqs = append(reqs, req)
+	}
+
+	fullMethod := fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    string(method.Name()),
+		ServerStreams: method.IsStreamingServer(),
+		ClientStreams: method.IsStreamingClient(),
+	}, fullMethod)
+	if err != nil {
+		return err
+	}
+	for _, req := range reqs {
+		if err := stream.SendMsg(req); err != nil {
+			return err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	logger.Printf("Invoke %s", fullMethod)
+	marshaler := protojson.MarshalOptions{Multiline: true}
+	for {
+		resp := dynamicpb.NewMessage(method.Output())
+		err := stream.RecvMsg(resp)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		b, err := marshaler.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		logger.Println(string(b))
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by the client itself.
+const instrumentationName = "github.com/zchee/go-googlecloud-samples/run/grpc-ping/client"
+
+// traceFlushTimeout is how long the client waits for its spans to be exported before exiting.
+const traceFlushTimeout = 5 * time.Second
+
+var (
+	tracerProvider *sdktrace.TracerProvider
+
+	// traceOut is the file spans are written to by the "file" exporter, closed once tracerProvider is shut down.
+	traceOut *os.File
+
+	// rootSpan covers the whole run of the client, the RPCs are its children.
+	rootSpan trace.Span = trace.SpanFromContext(context.Background())
+)
+
+// setupTracing installs the W3C Trace Context propagator and, when exporter is not empty, a TracerProvider exporting
+// spans to the OpenTelemetry collector ("otlp"), stdout ("stdout") or file ("file").
+func setupTracing(ctx context.Context, exporter, file string) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "":
+		return nil
+	case "otlp":
+		exp, err = otlptracegrpc.New(ctx)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case "file":
+		traceOut, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(traceOut))
+	default:
+		return fmt.Errorf("unknown trace exporter %q: must be one of \"otlp\", \"stdout\" or \"file\"", exporter)
+	}
+	if err != nil {
+		return err
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("grpc-ping-client"))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	return nil
+}
+
+// startRootSpan starts rootSpan, named after the mode of the client.
+func startRootSpan(ctx context.Context, name string) context.Context {
+	ctx, rootSpan = otel.Tracer(instrumentationName).Start(ctx, name)
+	return ctx
+}
+
+// endTracing ends rootSpan, recording err if not nil, and exports the pending spans.
+func endTracing(err error) {
+	if err != nil {
+		rootSpan.SetStatus(codes.Error, err.Error())
+	}
+	rootSpan.End()
+
+	if tracerProvider == nil {
+		return
+	}
+	logger.Printf("Trace ID: %s", rootSpan.SpanContext().TraceID())
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		logger.Printf("Failed to export traces: %v", err)
+	}
+	if traceOut != nil {
+		if err := traceOut.Close(); err != nil {
+			logger.Printf("Failed to close trace file: %v", err)
+		}
+	}
+}
+
+// fatalf is logger.Fatalf, exporting the spans of the failed run first.
+func fatalf(format string, v ...interface{}) {
+	endTracing(fmt.Errorf(format, v...))
+	logger.Fatalf(format, v...)
+}
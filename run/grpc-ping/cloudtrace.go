@@ -0,0 +1,149 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+// cloudTraceContextHeader is the legacy trace context header of Google Cloud, set by Cloud Run on incoming requests:
+// TRACE_ID/SPAN_ID;o=OPTIONS, where TRACE_ID is hexadecimal, SPAN_ID decimal and OPTIONS 1 if the trace is sampled.
+const cloudTraceContextHeader = "x-cloud-trace-context"
+
+// The fields correlating a log entry with its trace in Cloud Logging.
+// See https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+const (
+	traceLogKey        = "logging.googleapis.com/trace"
+	spanIDLogKey       = "logging.googleapis.com/spanId"
+	traceSampledLogKey = "logging.googleapis.com/trace_sampled"
+)
+
+// withIncomingTrace returns ctx carrying the trace of the incoming request, and logger with its trace fields,
+// so the log entries of the request are grouped with the entries of the relay and upstream servers.
+//
+// The span of ctx started by the tracing interceptors is used if it continues the incoming trace, or if the request
+// carries none. Otherwise the trace comes from the traceparent or X-Cloud-Trace-Context headers of the incoming
+// metadata, in that order. logger is returned unchanged when the request carries no trace ID at all.
+func withIncomingTrace(ctx context.Context, logger *zap.Logger, projectID string) (context.Context, *zap.Logger) {
+	sc := incomingSpanContext(ctx)
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() && (!sc.IsValid() || span.TraceID() == sc.TraceID()) {
+		sc = span
+	} else if sc.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+	if !sc.TraceID().IsValid() {
+		return ctx, logger
+	}
+
+	fields := []zap.Field{zap.String(traceLogKey, fmt.Sprintf("projects/%s/traces/%s", projectID, sc.TraceID()))}
+	// X-Cloud-Trace-Context may carry a trace ID alone, which still correlates the entries with the trace.
+	if sc.SpanID().IsValid() {
+		fields = append(fields, zap.String(spanIDLogKey, sc.SpanID().String()))
+	}
+	fields = append(fields, zap.Bool(traceSampledLogKey, sc.IsSampled()))
+
+	return ctx, logger.With(fields...)
+}
+
+// incomingSpanContext returns the span context of the traceparent or X-Cloud-Trace-Context headers of the incoming
+// metadata of ctx, or an invalid one. It may hold a trace ID without a span ID, see parseCloudTraceContext.
+func incomingSpanContext(ctx context.Context) trace.SpanContext {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), metadataCarrier(md))); sc.IsValid() {
+		return sc
+	}
+	if v := md.Get(cloudTraceContextHeader); len(v) > 0 {
+		return parseCloudTraceContext(v[0])
+	}
+	return trace.SpanContext{}
+}
+
+// parseCloudTraceContext parses an X-Cloud-Trace-Context header value. It returns an invalid span context if v is malformed,
+// and one with a valid trace ID but no span ID if only the span ID is missing or malformed.
+func parseCloudTraceContext(v string) trace.SpanContext {
+	ids, options, _ := strings.Cut(v, ";")
+	traceIDHex, spanIDDec, _ := strings.Cut(ids, "/")
+
+	traceID, err := trace.TraceIDFromHex(traceIDHex)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	var spanID trace.SpanID
+	if n, err := strconv.ParseUint(spanIDDec, 10, 64); err == nil {
+		binary.BigEndian.PutUint64(spanID[:], n)
+	}
+	var flags trace.TraceFlags
+	if options == "o=1" {
+		flags = trace.FlagsSampled
+	}
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	})
+}
+
+// withOutgoingCloudTraceContext returns ctx with the X-Cloud-Trace-Context header of its span in the outgoing metadata,
+// for the upstream servers which do not understand traceparent. traceparent itself is set by the tracing interceptors.
+func withOutgoingCloudTraceContext(ctx context.Context) context.Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ctx
+	}
+	spanID := sc.SpanID()
+	options := 0
+	if sc.IsSampled() {
+		options = 1
+	}
+
+	v := fmt.Sprintf("%s/%d;o=%d", sc.TraceID(), binary.BigEndian.Uint64(spanID[:]), options)
+	return metadata.AppendToOutgoingContext(ctx, cloudTraceContextHeader, v)
+}
+
+// metadataCarrier adapts metadata.MD to propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+// Get implements propagation.TextMapCarrier.
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Set implements propagation.TextMapCarrier.
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Keys implements propagation.TextMapCarrier.
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/metadata"
+)
+
+const testTraceID = "105445aa7843bc8bf206b12000100000"
+
+func TestParseCloudTraceContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantTraceID string
+		wantSpanID  string
+		wantSampled bool
+	}{
+		{
+			name:        "sampled",
+			value:       testTraceID + "/1;o=1",
+			wantTraceID: testTraceID,
+			wantSpanID:  "0000000000000001",
+			wantSampled: true,
+		},
+		{
+			name:        "not sampled",
+			value:       testTraceID + "/18446744073709551615;o=0",
+			wantTraceID: testTraceID,
+			wantSpanID:  "ffffffffffffffff",
+		},
+		{
+			name:        "no options",
+			value:       testTraceID + "/256",
+			wantTraceID: testTraceID,
+			wantSpanID:  "0000000000000100",
+		},
+		{
+			name:        "no span ID",
+			value:       testTraceID + ";o=1",
+			wantTraceID: testTraceID,
+			wantSpanID:  "0000000000000000",
+			wantSampled: true,
+		},
+		{
+			name:        "hexadecimal span ID",
+			value:       testTraceID + "/ab;o=1",
+			wantTraceID: testTraceID,
+			wantSpanID:  "0000000000000000",
+			wantSampled: true,
+		},
+		{
+			name:        "malformed trace ID",
+			value:       "not-a-trace-id/1;o=1",
+			wantTraceID: "00000000000000000000000000000000",
+			wantSpanID:  "0000000000000000",
+		},
+		{
+			name:        "short trace ID",
+			value:       "105445aa/1;o=1",
+			wantTraceID: "00000000000000000000000000000000",
+			wantSpanID:  "0000000000000000",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sc := parseCloudTraceContext(tt.value)
+			if got := sc.TraceID().String(); got != tt.wantTraceID {
+				t.Errorf("trace ID = %s, want %s", got, tt.wantTraceID)
+			}
+			if got := sc.SpanID().String(); got != tt.wantSpanID {
+				t.Errorf("span ID = %s, want %s", got, tt.wantSpanID)
+			}
+			if got := sc.IsSampled(); got != tt.wantSampled {
+				t.Errorf("sampled = %v, want %v", got, tt.wantSampled)
+			}
+		})
+	}
+}
+
+func TestCloudTraceContextRoundTrip(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex(testTraceID)
+	spanID, _ := trace.SpanIDFromHex("fedcba9876543210")
+
+	for _, flags := range []trace.TraceFlags{0, trace.FlagsSampled} {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: flags})
+		ctx := withOutgoingCloudTraceContext(trace.ContextWithSpanContext(context.Background(), sc))
+
+		md, _ := metadata.FromOutgoingContext(ctx)
+		v := md.Get(cloudTraceContextHeader)
+		if len(v) != 1 {
+			t.Fatalf("%s = %q, want a single value", cloudTraceContextHeader, v)
+		}
+		got := parseCloudTraceContext(v[0])
+		if !got.Equal(sc.WithRemote(true)) {
+			t.Errorf("parseCloudTraceContext(%q) = %v, want %v", v[0], got, sc)
+		}
+	}
+}
+
+func TestWithIncomingTraceWithoutSpanID(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	md := metadata.Pairs(cloudTraceContextHeader, testTraceID+";o=1")
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	_, logger := withIncomingTrace(ctx, zap.New(core), "test-project")
+	logger.Info("test")
+
+	fields := logs.All()[0].ContextMap()
+	if got, want := fields[traceLogKey], "projects/test-project/traces/"+testTraceID; got != want {
+		t.Errorf("%s = %v, want %v", traceLogKey, got, want)
+	}
+	if got, ok := fields[spanIDLogKey]; ok {
+		t.Errorf("%s = %v, want none", spanIDLogKey, got)
+	}
+	if got := fields[traceSampledLogKey]; got != true {
+		t.Errorf("%s = %v, want true", traceSampledLogKey, got)
+	}
+}
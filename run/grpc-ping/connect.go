@@ -0,0 +1,373 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+	"github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1/v1connect"
+)
+
+// newConnectHandler returns the path and http.Handler serving svc over the Connect protocol, wrapped by interceptors.
+func newConnectHandler(svc *pingService, interceptors ...connect.Interceptor) (string, http.Handler) {
+	// Expose the request headers as incoming metadata first, like gRPC does, for the interceptors and svc reading it.
+	interceptors = append([]connect.Interceptor{connectInterceptorFunc(incomingMetadata)}, interceptors...)
+
+	return v1connect.NewPingServiceHandler(&connectPingService{svc: svc}, connect.WithInterceptors(interceptors...))
+}
+
+// connectInterceptorFunc wraps every call of a Connect handler, unary and streaming.
+// header holds the request headers, call runs the handler with ctx.
+type connectInterceptorFunc func(ctx context.Context, spec connect.Spec, header http.Header, call func(ctx context.Context) error) error
+
+// WrapUnary implements connect.Interceptor.
+func (f connectInterceptorFunc) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		var resp connect.AnyResponse
+		err := f(ctx, req.Spec(), req.Header(), func(ctx context.Context) error {
+			var err error
+			resp, err = next(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+// WrapStreamingClient implements connect.Interceptor. connectInterceptorFunc only applies to handlers.
+func (f connectInterceptorFunc) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements connect.Interceptor.
+func (f connectInterceptorFunc) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		return f(ctx, conn.Spec(), conn.RequestHeader(), func(ctx context.Context) error {
+			return next(ctx, conn)
+		})
+	}
+}
+
+// incomingMetadata is a connectInterceptorFunc storing the request headers in ctx as incoming gRPC metadata.
+func incomingMetadata(ctx context.Context, spec connect.Spec, header http.Header, call func(ctx context.Context) error) error {
+	md := make(metadata.MD, len(header))
+	for k, v := range header {
+		md.Append(strings.ToLower(k), v...)
+	}
+	return call(metadata.NewIncomingContext(ctx, md))
+}
+
+// connectError converts the gRPC status error err to a Connect error with the same code, message and details.
+func connectError(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	cerr := connect.NewError(connect.Code(st.Code()), errors.New(st.Message()))
+	for _, d := range st.Details() {
+		if m, ok := d.(proto.Message); ok {
+			if detail, err := connect.NewErrorDetail(m); err == nil {
+				cerr.AddDetail(detail)
+			}
+		}
+	}
+	return cerr
+}
+
+// connectPingService implements v1connect.PingServiceHandler with pingService.
+type connectPingService struct {
+	svc *pingService
+}
+
+var _ v1connect.PingServiceHandler = (*connectPingService)(nil)
+
+// Send implements v1connect.PingServiceHandler.
+func (s *connectPingService) Send(ctx context.Context, req *connect.Request[pb.Request]) (*connect.Response[pb.Response], error) {
+	return serveUnary(ctx, req, s.svc.Send)
+}
+
+// SendUpstream implements v1connect.PingServiceHandler.
+func (s *connectPingService) SendUpstream(ctx context.Context, req *connect.Request[pb.Request]) (*connect.Response[pb.Response], error) {
+	return serveUnary(ctx, req, s.svc.SendUpstream)
+}
+
+// Broadcast implements v1connect.PingServiceHandler.
+func (s *connectPingService) Broadcast(ctx context.Context, req *connect.Request[pb.BroadcastRequest]) (*connect.Response[pb.BroadcastResponse], error) {
+	return serveUnary(ctx, req, s.svc.Broadcast)
+}
+
+// ServerInfo implements v1connect.PingServiceHandler.
+func (s *connectPingService) ServerInfo(ctx context.Context, req *connect.Request[pb.ServerInfoRequest]) (*connect.Response[pb.ServerInfoResponse], error) {
+	return serveUnary(ctx, req, s.svc.ServerInfo)
+}
+
+// serveUnary serves req with the unary pingService method. The headers and trailers method sets with grpc.SetHeader
+// and grpc.SetTrailer are set on the response, or on the error.
+func serveUnary[Req, Res any](ctx context.Context, req *connect.Request[Req], method func(context.Context, *Req) (*Res, error)) (*connect.Response[Res], error) {
+	stream := &unaryTransportStream{method: req.Spec().Procedure, header: make(http.Header), trailer: make(http.Header)}
+	resp, err := method(grpc.NewContextWithServerTransportStream(ctx, stream), req.Msg)
+	if err != nil {
+		err = connectError(err)
+		if connectErr := new(connect.Error); errors.As(err, &connectErr) {
+			addHeader(connectErr.Meta(), stream.header)
+			addHeader(connectErr.Meta(), stream.trailer)
+		}
+		return nil, err
+	}
+
+	r := connect.NewResponse(resp)
+	addHeader(r.Header(), stream.header)
+	addHeader(r.Trailer(), stream.trailer)
+	return r, nil
+}
+
+// unaryTransportStream collects the headers and trailers of the unary pingService methods served by serveUnary.
+type unaryTransportStream struct {
+	method  string
+	header  http.Header
+	trailer http.Header
+}
+
+var _ grpc.ServerTransportStream = (*unaryTransportStream)(nil)
+
+// Method implements grpc.ServerTransportStream.
+func (s *unaryTransportStream) Method() string {
+	return s.method
+}
+
+// SetHeader implements grpc.ServerTransportStream.
+func (s *unaryTransportStream) SetHeader(md metadata.MD) error {
+	addMetadata(s.header, md)
+	return nil
+}
+
+// SendHeader implements grpc.ServerTransportStream. Connect sends the headers with the response.
+func (s *unaryTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+// SetTrailer implements grpc.ServerTransportStream.
+func (s *unaryTransportStream) SetTrailer(md metadata.MD) error {
+	addMetadata(s.trailer, md)
+	return nil
+}
+
+// addMetadata adds the values of md to h.
+func addMetadata(h http.Header, md metadata.MD) {
+	for k, v := range md {
+		for _, v := range v {
+			h.Add(k, v)
+		}
+	}
+}
+
+// addHeader adds the values of src to dst.
+func addHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = append(dst[k], v...)
+	}
+}
+
+// Subscribe implements v1connect.PingServiceHandler.
+func (s *connectPingService) Subscribe(ctx context.Context, req *connect.Request[pb.SubscribeRequest], stream *connect.ServerStream[pb.Response]) error {
+	return connectError(s.svc.Subscribe(req.Msg, newServerStreamAdapter(ctx, stream)))
+}
+
+// SubscribeUpstream implements v1connect.PingServiceHandler.
+func (s *connectPingService) SubscribeUpstream(ctx context.Context, req *connect.Request[pb.SubscribeRequest], stream *connect.ServerStream[pb.Response]) error {
+	return connectError(s.svc.SubscribeUpstream(req.Msg, newServerStreamAdapter(ctx, stream)))
+}
+
+// PingPong implements v1connect.PingServiceHandler.
+func (s *connectPingService) PingPong(ctx context.Context, stream *connect.BidiStream[pb.Request, pb.Response]) error {
+	return connectError(s.svc.PingPong(newBidiStreamAdapter(ctx, stream)))
+}
+
+// PingPongUpstream implements v1connect.PingServiceHandler.
+func (s *connectPingService) PingPongUpstream(ctx context.Context, stream *connect.BidiStream[pb.Request, pb.Response]) error {
+	return connectError(s.svc.PingPongUpstream(newBidiStreamAdapter(ctx, stream)))
+}
+
+// SendBatch implements v1connect.PingServiceHandler.
+func (s *connectPingService) SendBatch(ctx context.Context, stream *connect.ClientStream[pb.Request]) (*connect.Response[pb.BatchResponse], error) {
+	adapter := newClientStreamAdapter(ctx, stream)
+	if err := s.svc.SendBatch(adapter); err != nil {
+		return nil, connectError(err)
+	}
+	return adapter.response(), nil
+}
+
+// SendBatchUpstream implements v1connect.PingServiceHandler.
+func (s *connectPingService) SendBatchUpstream(ctx context.Context, stream *connect.ClientStream[pb.Request]) (*connect.Response[pb.BatchResponse], error) {
+	adapter := newClientStreamAdapter(ctx, stream)
+	if err := s.svc.SendBatchUpstream(adapter); err != nil {
+		return nil, connectError(err)
+	}
+	return adapter.response(), nil
+}
+
+// streamAdapter adapts a Connect stream to the grpc.ServerStream based interfaces of pingService,
+// e.g. pb.PingService_PingPongServer.
+type streamAdapter[Req, Res any] struct {
+	ctx     context.Context
+	recv    func() (*Req, error)
+	send    func(*Res) error
+	header  http.Header
+	trailer http.Header
+}
+
+func newServerStreamAdapter(ctx context.Context, stream *connect.ServerStream[pb.Response]) *streamAdapter[pb.SubscribeRequest, pb.Response] {
+	return &streamAdapter[pb.SubscribeRequest, pb.Response]{
+		ctx: ctx,
+		recv: func() (*pb.SubscribeRequest, error) {
+			return nil, errors.New("server-streaming RPCs do not receive messages")
+		},
+		send:    stream.Send,
+		header:  stream.ResponseHeader(),
+		trailer: stream.ResponseTrailer(),
+	}
+}
+
+func newBidiStreamAdapter(ctx context.Context, stream *connect.BidiStream[pb.Request, pb.Response]) *streamAdapter[pb.Request, pb.Response] {
+	return &streamAdapter[pb.Request, pb.Response]{
+		ctx: ctx,
+		recv: func() (*pb.Request, error) {
+			req, err := stream.Receive()
+			// pingService expects io.EOF itself at the end of the stream, as gRPC returns it.
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return req, err
+		},
+		send:    stream.Send,
+		header:  stream.ResponseHeader(),
+		trailer: stream.ResponseTrailer(),
+	}
+}
+
+// clientStreamAdapter keeps the message sent by SendAndClose to return it once the handler is done.
+type clientStreamAdapter struct {
+	*streamAdapter[pb.Request, pb.BatchResponse]
+	resp *pb.BatchResponse
+}
+
+func newClientStreamAdapter(ctx context.Context, stream *connect.ClientStream[pb.Request]) *clientStreamAdapter {
+	a := &clientStreamAdapter{}
+	a.streamAdapter = &streamAdapter[pb.Request, pb.BatchResponse]{
+		ctx: ctx,
+		recv: func() (*pb.Request, error) {
+			if !stream.Receive() {
+				if err := stream.Err(); err != nil {
+					return nil, err
+				}
+				return nil, io.EOF
+			}
+			return stream.Msg(), nil
+		},
+		send: func(resp *pb.BatchResponse) error {
+			a.resp = resp
+			return nil
+		},
+		header:  make(http.Header),
+		trailer: make(http.Header),
+	}
+	return a
+}
+
+// response returns the message sent by SendAndClose, with the headers and trailers set by the handler.
+func (a *clientStreamAdapter) response() *connect.Response[pb.BatchResponse] {
+	resp := connect.NewResponse(a.resp)
+	addHeader(resp.Header(), a.header)
+	addHeader(resp.Trailer(), a.trailer)
+	return resp
+}
+
+// Context implements grpc.ServerStream.
+func (s *streamAdapter[Req, Res]) Context() context.Context {
+	return s.ctx
+}
+
+// Recv receives the next message, or io.EOF once the client is done sending.
+func (s *streamAdapter[Req, Res]) Recv() (*Req, error) {
+	return s.recv()
+}
+
+// Send sends m to the client.
+func (s *streamAdapter[Req, Res]) Send(m *Res) error {
+	return s.send(m)
+}
+
+// SendAndClose sends m, the response of a client-streaming RPC.
+func (s *streamAdapter[Req, Res]) SendAndClose(m *Res) error {
+	return s.send(m)
+}
+
+// SetHeader implements grpc.ServerStream.
+func (s *streamAdapter[Req, Res]) SetHeader(md metadata.MD) error {
+	addMetadata(s.header, md)
+	return nil
+}
+
+// SendHeader implements grpc.ServerStream. Connect sends the headers with the first message.
+func (s *streamAdapter[Req, Res]) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+// SetTrailer implements grpc.ServerStream.
+func (s *streamAdapter[Req, Res]) SetTrailer(md metadata.MD) {
+	addMetadata(s.trailer, md)
+}
+
+// SendMsg implements grpc.ServerStream.
+func (s *streamAdapter[Req, Res]) SendMsg(m interface{}) error {
+	res, ok := m.(*Res)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", m)
+	}
+	return s.send(res)
+}
+
+// RecvMsg implements grpc.ServerStream.
+func (s *streamAdapter[Req, Res]) RecvMsg(m interface{}) error {
+	dst, ok := m.(proto.Message)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", m)
+	}
+	req, err := s.recv()
+	if err != nil {
+		return err
+	}
+	src, ok := interface{}(req).(proto.Message)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", req)
+	}
+	proto.Reset(dst)
+	proto.Merge(dst, src)
+	return nil
+}
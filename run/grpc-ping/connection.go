@@ -20,16 +20,22 @@ import (
 	"crypto/x509"
 
 	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	grpc_insecure "google.golang.org/grpc/credentials/insecure"
 )
 
-// NewConn creates a new gRPC connection.
+// NewConn creates a new gRPC connection, with extraOpts in addition to the default options.
 // host should be of the form domain:port, e.g., example.com:443
-func NewConn(ctx context.Context, host string, insecure bool) (*grpc.ClientConn, error) {
-	var opts []grpc.DialOption
+func NewConn(ctx context.Context, host string, insecure bool, extraOpts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{
+		// Trace first, so the upstream metrics and logs are recorded within the client span.
+		grpc.WithChainUnaryInterceptor(otelgrpc.UnaryClientInterceptor(), upstreamMetrics.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(otelgrpc.StreamClientInterceptor(), upstreamMetrics.StreamClientInterceptor()),
+	}
+	opts = append(opts, extraOpts...)
 	if host != "" {
 		opts = append(opts, grpc.WithAuthority(host))
 	}
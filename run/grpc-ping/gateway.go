@@ -0,0 +1,172 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+)
+
+// newHTTPHandler returns an http.Handler routing requests by content type: gRPC requests are served by gsrv,
+// gRPC-Web requests by grpcWeb, and everything else, e.g. Connect and REST/JSON requests, by handler.
+//
+// Routing requests rather than connections lets Cloud Run, which sends every request over HTTP/2 when
+// --use-http2 is set, mix every kind of request on the same connection.
+func newHTTPHandler(gsrv *grpc.Server, grpcWeb *grpcWebServer, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			gsrv.ServeHTTP(w, r)
+			return
+		}
+		if grpcWeb.IsGRPCWebRequest(r) {
+			grpcWeb.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// isGRPCRequest reports whether r is a native gRPC request: application/grpc or application/grpc+<codec> over HTTP/2.
+func isGRPCRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return r.ProtoMajor == 2 && (contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+"))
+}
+
+// newGatewayHandler returns an http.Handler serving the REST/JSON front end of svc.
+//
+// Requests call svc in-process through interceptors, the chain of Unary interceptors of the gRPC server, so they are
+// authenticated, logged and recorded once, like native gRPC calls. A loopback gRPC connection would run them twice.
+func newGatewayHandler(ctx context.Context, svc pb.PingServiceServer, interceptors ...grpc.UnaryServerInterceptor) (http.Handler, error) {
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher))
+	srv := &gatewayServer{
+		PingServiceServer: svc,
+		interceptor:       chainUnaryInterceptors(interceptors),
+	}
+	if err := pb.RegisterPingServiceHandlerServer(ctx, mux, srv); err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Give the calls the peer of the HTTP request, as gRPC calls have the one of their connection.
+		if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+			r = r.WithContext(peer.NewContext(r.Context(), &peer.Peer{Addr: net.TCPAddrFromAddrPort(addr)}))
+		}
+		mux.ServeHTTP(w, r)
+	}), nil
+}
+
+// gatewayServer calls the Unary methods of a PingServiceServer through an interceptor, as grpc.Server does.
+type gatewayServer struct {
+	pb.PingServiceServer
+	interceptor grpc.UnaryServerInterceptor
+}
+
+// Send implements pb.PingServiceServer.
+func (s *gatewayServer) Send(ctx context.Context, req *pb.Request) (*pb.Response, error) {
+	resp, err := s.invoke(ctx, "Send", req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.Response), nil
+}
+
+// SendUpstream implements pb.PingServiceServer.
+func (s *gatewayServer) SendUpstream(ctx context.Context, req *pb.Request) (*pb.Response, error) {
+	resp, err := s.invoke(ctx, "SendUpstream", req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.Response), nil
+}
+
+// Broadcast implements pb.PingServiceServer.
+func (s *gatewayServer) Broadcast(ctx context.Context, req *pb.BroadcastRequest) (*pb.BroadcastResponse, error) {
+	resp, err := s.invoke(ctx, "Broadcast", req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.BroadcastResponse), nil
+}
+
+// invoke calls the Unary method of PingService with req through the generated handler, which runs s.interceptor
+// with the same grpc.UnaryServerInfo as grpc.Server.
+func (s *gatewayServer) invoke(ctx context.Context, method string, req proto.Message) (interface{}, error) {
+	for _, m := range pb.PingService_ServiceDesc.Methods {
+		if m.MethodName != method {
+			continue
+		}
+		dec := func(in interface{}) error {
+			proto.Merge(in.(proto.Message), req)
+			return nil
+		}
+		return m.Handler(s.PingServiceServer, ctx, dec, s.interceptor)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method %s not implemented", method)
+}
+
+// chainUnaryInterceptors returns a grpc.UnaryServerInterceptor running interceptors in order, the first one outermost,
+// like grpc.ChainUnaryInterceptor.
+func chainUnaryInterceptors(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// gatewayHeaderMatcher forwards the W3C Trace Context and X-Cloud-Trace-Context headers to the incoming metadata along
+// with the default ones, so the call continues the trace of the REST/JSON request.
+func gatewayHeaderMatcher(key string) (string, bool) {
+	switch strings.ToLower(key) {
+	case "traceparent", "tracestate", cloudTraceContextHeader:
+		return strings.ToLower(key), true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// newHTTPServer returns an http.Server serving handler over HTTP/1.1 and HTTP/2 without TLS, as Cloud Run
+// terminates TLS in front of the container.
+func newHTTPServer(handler http.Handler) (*http.Server, error) {
+	h2s := &http2.Server{}
+	srv := &http.Server{
+		Handler:           h2c.NewHandler(handler, h2s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Let Shutdown send GOAWAY on the HTTP/2 connections too, h2c takes them over from srv.
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return nil, err
+	}
+
+	return srv, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+)
+
+func TestGatewayHandler(t *testing.T) {
+	var calls []string
+	// record checks the call carries the context of a gRPC call, the request-scoped logger is set by the next one.
+	record := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		calls = append(calls, "record:"+info.FullMethod)
+		if _, ok := peer.FromContext(ctx); !ok {
+			t.Error("no peer in the context of the call")
+		}
+		if md, _ := metadata.FromIncomingContext(ctx); len(md.Get("authorization")) == 0 {
+			t.Error("authorization header not forwarded as metadata")
+		}
+		return handler(ctx, req)
+	}
+	withLogger := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		calls = append(calls, "logger:"+info.FullMethod)
+		return handler(zapcloudlogging.NewContext(ctx, zap.NewNop()), req)
+	}
+
+	svc := &pingService{info: &pb.ServerInfo{Service: "grpc-ping"}}
+	h, err := newGatewayHandler(context.Background(), svc, record, withLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/ping", strings.NewReader(`{"message": "Hello REST!"}`))
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp pb.Response
+	if err := protojson.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.GetPong().GetMessage(), "Hello REST!"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+
+	// Each interceptor runs once, in order.
+	want := []string{"record:/ping.PingService/Send", "logger:/ping.PingService/Send"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("interceptor calls = %q, want %q", calls, want)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+)
+
+// grpcWebHeaders are the request headers sent by gRPC-Web clients, always allowed by corsPolicy.
+var grpcWebHeaders = []string{"Content-Type", "X-Grpc-Web", "X-User-Agent", "Grpc-Timeout", "Authorization"}
+
+// grpcWebTrailers are the trailers carrying the status of gRPC-Web responses, always exposed by corsPolicy.
+var grpcWebTrailers = []string{"Grpc-Status", "Grpc-Message"}
+
+// corsPolicy is the CORS policy of gRPC-Web requests, so browsers may call the server from other origins.
+type corsPolicy struct {
+	// origins lists the allowed origins, "*" allows any origin. Only same-origin requests are allowed when empty.
+	origins []string
+
+	// headers lists the request headers allowed in addition to grpcWebHeaders.
+	headers []string
+
+	// exposeHeaders lists the response headers and trailers exposed in addition to grpcWebTrailers.
+	// Every response header is exposed when empty.
+	exposeHeaders []string
+}
+
+// AllowOrigin reports whether requests from origin are allowed.
+func (p corsPolicy) AllowOrigin(origin string) bool {
+	for _, o := range p.origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// newGRPCWebServer wraps gsrv so it also serves gRPC-Web requests, in binary and text format, with the CORS policy.
+//
+// It only handles gRPC-Web requests and their CORS preflight requests, see IsGRPCWebRequest.
+func newGRPCWebServer(gsrv *grpc.Server, policy corsPolicy) *grpcWebServer {
+	wrapped := grpcweb.WrapServer(gsrv,
+		grpcweb.WithOriginFunc(policy.AllowOrigin),
+		grpcweb.WithAllowedRequestHeaders(append(append([]string{}, grpcWebHeaders...), policy.headers...)),
+		grpcweb.WithCorsForRegisteredEndpointsOnly(true),
+	)
+
+	var expose string
+	if len(policy.exposeHeaders) > 0 {
+		expose = strings.Join(append(append([]string{}, grpcWebTrailers...), policy.exposeHeaders...), ", ")
+	}
+
+	return &grpcWebServer{
+		wrapped: wrapped,
+		expose:  expose,
+	}
+}
+
+// grpcWebServer serves gRPC-Web requests.
+type grpcWebServer struct {
+	wrapped *grpcweb.WrappedGrpcServer
+
+	// expose overrides the Access-Control-Expose-Headers header of the responses if not empty.
+	expose string
+}
+
+// IsGRPCWebRequest reports whether r is a gRPC-Web request, or the CORS preflight request of one.
+func (s *grpcWebServer) IsGRPCWebRequest(r *http.Request) bool {
+	return s.wrapped.IsGrpcWebRequest(r) || s.wrapped.IsAcceptableGrpcCorsRequest(r)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *grpcWebServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.expose != "" {
+		w = &exposeHeadersWriter{ResponseWriter: w, expose: s.expose}
+	}
+	s.wrapped.ServeHTTP(w, r)
+}
+
+// exposeHeadersWriter replaces the Access-Control-Expose-Headers header set by grpcweb, which exposes every header.
+type exposeHeadersWriter struct {
+	http.ResponseWriter
+	expose      string
+	wroteHeader bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *exposeHeadersWriter) WriteHeader(statusCode int) {
+	w.setExposeHeaders()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter.
+func (w *exposeHeadersWriter) Write(b []byte) (int, error) {
+	w.setExposeHeaders()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *exposeHeadersWriter) setExposeHeaders() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.Header().Get("Access-Control-Expose-Headers") != "" {
+		w.Header().Set("Access-Control-Expose-Headers", w.expose)
+	}
+}
+
+// Flush implements http.Flusher, grpcweb flushes every message of server-streaming responses.
+func (w *exposeHeadersWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
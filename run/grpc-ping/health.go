@@ -0,0 +1,225 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+)
+
+// healthChecker computes the serving status reported by the grpc.health.v1.Health service.
+//
+// The server as a whole, the empty service name, is SERVING until it shuts down.
+// PingService is NOT_SERVING while the connection to the primary upstream service is in TRANSIENT_FAILURE or its
+// circuit breaker is open, since it cannot relay requests then. The other upstream services only serve Broadcast.
+// Watch streams are notified of every change, and end once they reported NOT_SERVING after Shutdown.
+type healthChecker struct {
+	srv *health.Server
+
+	// shuttingDown is closed by Shutdown.
+	shuttingDown chan struct{}
+
+	mu            sync.Mutex
+	upstreamState connectivity.State
+	circuitState  breakerState
+	status        healthpb.HealthCheckResponse_ServingStatus
+}
+
+func newHealthChecker() *healthChecker {
+	h := &healthChecker{
+		srv:           health.NewServer(),
+		shuttingDown:  make(chan struct{}),
+		upstreamState: connectivity.Idle,
+		circuitState:  breakerClosed,
+		status:        healthpb.HealthCheckResponse_SERVING,
+	}
+	h.srv.SetServingStatus(pb.PingService_ServiceDesc.ServiceName, h.status)
+
+	return h
+}
+
+// Register registers the health service on gsrv.
+func (h *healthChecker) Register(gsrv *grpc.Server) {
+	healthpb.RegisterHealthServer(gsrv, h)
+}
+
+// Check implements healthpb.HealthServer.
+func (h *healthChecker) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return h.srv.Check(ctx, req)
+}
+
+// Watch implements healthpb.HealthServer.
+//
+// health.Server.Watch only returns once the client goes away. After Shutdown the stream ends as soon as it reported
+// a status other than SERVING instead, so clients learn the server is going away and reconnect elsewhere.
+func (h *healthChecker) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	ws := &healthWatchStream{
+		Health_WatchServer: stream,
+		ctx:                ctx,
+		sent:               make(chan healthpb.HealthCheckResponse_ServingStatus, 1),
+	}
+	go func() {
+		select {
+		case <-h.shuttingDown:
+		case <-ctx.Done():
+			return
+		}
+		for {
+			select {
+			case s := <-ws.sent:
+				if s != healthpb.HealthCheckResponse_SERVING {
+					cancel()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err := h.srv.Watch(req, ws)
+	if stream.Context().Err() == nil && ctx.Err() != nil {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	return err
+}
+
+// healthWatchStream wraps healthpb.Health_WatchServer to report the statuses sent on the stream.
+type healthWatchStream struct {
+	healthpb.Health_WatchServer
+	ctx context.Context
+
+	// sent holds the last status sent.
+	sent chan healthpb.HealthCheckResponse_ServingStatus
+}
+
+// Context implements grpc.ServerStream.
+func (s *healthWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send implements healthpb.Health_WatchServer.
+func (s *healthWatchStream) Send(resp *healthpb.HealthCheckResponse) error {
+	if err := s.Health_WatchServer.Send(resp); err != nil {
+		return err
+	}
+	// Replace the status not read yet, Send is the only writer.
+	select {
+	case <-s.sent:
+	default:
+	}
+	s.sent <- resp.Status
+
+	return nil
+}
+
+// WatchUpstream keeps the status of PingService in sync with the state of the upstream connection until ctx is done.
+func (h *healthChecker) WatchUpstream(ctx context.Context, conn *grpc.ClientConn) {
+	for {
+		state := conn.GetState()
+		h.setUpstreamState(state)
+
+		// Connections are established lazily, connect right away so the status reflects the upstream reachability.
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return
+		}
+	}
+}
+
+// Shutdown sets every service NOT_SERVING, and keeps them so. Watch streams end once they reported it.
+func (h *healthChecker) Shutdown() {
+	h.srv.Shutdown()
+	close(h.shuttingDown)
+}
+
+func (h *healthChecker) setUpstreamState(state connectivity.State) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if state == h.upstreamState {
+		return
+	}
+	logger.Debug("upstream connection state changed", zap.Stringer("from", h.upstreamState), zap.Stringer("to", state))
+	h.upstreamState = state
+	h.update()
+}
+
+// SetCircuitState keeps the status of PingService in sync with the state of the circuit breaker of the upstream
+// requests, see circuitBreaker.OnStateChange.
+func (h *healthChecker) SetCircuitState(state breakerState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if state == h.circuitState {
+		return
+	}
+	h.circuitState = state
+	h.update()
+}
+
+// update recomputes the status of PingService. h.mu must be held.
+func (h *healthChecker) update() {
+	// Keep the current status while the connection is idle or connecting, it goes through these states between
+	// two connection attempts.
+	status := h.status
+	switch h.upstreamState {
+	case connectivity.Ready:
+		status = healthpb.HealthCheckResponse_SERVING
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	// A half-open circuit lets the probes through, only an open one rejects every request.
+	if h.circuitState == breakerOpen {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	if status == h.status {
+		return
+	}
+
+	logger.Info("health status changed", zap.String("service", pb.PingService_ServiceDesc.ServiceName), zap.Stringer("from", h.status), zap.Stringer("to", status))
+	h.status = status
+	h.srv.SetServingStatus(pb.PingService_ServiceDesc.ServiceName, status)
+}
+
+var (
+	healthMethodPrefix     = "/" + healthpb.Health_ServiceDesc.ServiceName + "/"
+	reflectionMethodPrefix = "/" + reflectionpb.ServerReflection_ServiceDesc.ServiceName + "/"
+)
+
+// isInfrastructureMethod reports whether the gRPC method belongs to the health or reflection services.
+//
+// Their calls are not PingService requests: probes and Watch or reflection streams, which last as long as their
+// client does, are neither drained on shutdown nor recorded in the metrics.
+func isInfrastructureMethod(method string) bool {
+	return strings.HasPrefix(method, healthMethodPrefix) || strings.HasPrefix(method, reflectionMethodPrefix)
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// fakeWatchStream is a healthpb.Health_WatchServer recording the statuses sent.
+type fakeWatchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan healthpb.HealthCheckResponse_ServingStatus
+}
+
+func (s *fakeWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeWatchStream) Send(resp *healthpb.HealthCheckResponse) error {
+	s.sent <- resp.Status
+	return nil
+}
+
+func TestHealthCheckerWatchEndsOnShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		want    []healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{
+			name: "server",
+			want: []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_NOT_SERVING},
+		},
+		{
+			name:    "unknown service",
+			service: "unknown.Service",
+			want:    []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_SERVICE_UNKNOWN},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHealthChecker()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream := &fakeWatchStream{ctx: ctx, sent: make(chan healthpb.HealthCheckResponse_ServingStatus, len(tt.want))}
+
+			errc := make(chan error, 1)
+			go func() {
+				errc <- h.Watch(&healthpb.HealthCheckRequest{Service: tt.service}, stream)
+			}()
+			if got := <-stream.sent; got != tt.want[0] {
+				t.Fatalf("first status = %v, want %v", got, tt.want[0])
+			}
+			h.Shutdown()
+
+			select {
+			case err := <-errc:
+				if got := status.Code(err); got != codes.Unavailable {
+					t.Errorf("Watch() code = %v, want %v: %v", got, codes.Unavailable, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Watch() did not return after Shutdown")
+			}
+			for _, want := range tt.want[1:] {
+				if got := <-stream.sent; got != want {
+					t.Errorf("status = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsInfrastructureMethod(t *testing.T) {
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"/grpc.health.v1.Health/Check", true},
+		{"/grpc.health.v1.Health/Watch", true},
+		{"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", true},
+		{"/ping.PingService/Send", false},
+		{"/grpc.health.v1.HealthCheck/Check", false},
+	}
+	for _, tt := range tests {
+		if got := isInfrastructureMethod(tt.method); got != tt.want {
+			t.Errorf("isInfrastructureMethod(%q) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
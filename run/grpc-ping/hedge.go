@@ -0,0 +1,321 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// hedgesHeader is the response metadata holding the number of hedged attempts sent to the upstream service.
+const hedgesHeader = "x-upstream-hedges"
+
+const (
+	// defaultHedgeDelay is the hedging delay of a percentile until enough latencies are measured.
+	defaultHedgeDelay = time.Second
+
+	// hedgeLatencySamples is the number of recent upstream latencies the percentile is computed from,
+	// hedgeMinSamples the number needed to compute it.
+	hedgeLatencySamples = 128
+	hedgeMinSamples     = 20
+)
+
+// upstreamHedge is the hedging policy of the requests to the upstream service.
+var upstreamHedge = defaultHedgePolicy()
+
+// hedgePolicy hedges the unary requests to the upstream service: when an attempt did not answer within the delay,
+// another one is sent, up to maxAttempts in flight, and the first success wins, cancelling the others.
+// The request fails once every attempt sent failed, without waiting for the delay, so failures are left to
+// upstreamRetry, which retries the hedged attempts as a whole.
+//
+// The delay is either fixed, or the percentile of the latencies of the recent attempts: those which succeeded, and
+// the losers canceled by the winner, whose elapsed time is a lower bound of their latency. Sampling winners only would
+// skew the percentile low, and hedge more and more requests.
+type hedgePolicy struct {
+	// maxAttempts is the number of attempts, including the first one. Requests are not hedged if it is 1.
+	maxAttempts int
+
+	// delay is the fixed delay, unless percentile is not zero.
+	delay      time.Duration
+	percentile float64
+	latencies  latencyWindow
+
+	hedges *prometheus.CounterVec
+	wins   *prometheus.CounterVec
+}
+
+var _ prometheus.Collector = (*hedgePolicy)(nil)
+
+func defaultHedgePolicy() *hedgePolicy {
+	return &hedgePolicy{
+		maxAttempts: 1,
+		latencies:   latencyWindow{samples: make([]time.Duration, 0, hedgeLatencySamples)},
+		hedges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "upstream",
+			Name:      "hedged_attempts_total",
+			Help:      "Hedged attempts sent to the upstream service, by attempt number.",
+		}, []string{"attempt"}),
+		wins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "upstream",
+			Name:      "hedged_wins_total",
+			Help:      "Hedged upstream requests which succeeded, by the number of the attempt which answered first.",
+		}, []string{"attempt"}),
+	}
+}
+
+// hedgePolicyFromEnv returns the hedging policy of the GRPC_PING_HEDGE_* environment variables. Requests are not hedged
+// unless GRPC_PING_HEDGE_DELAY is set.
+func hedgePolicyFromEnv() (*hedgePolicy, error) {
+	p := defaultHedgePolicy()
+
+	v := os.Getenv("GRPC_PING_HEDGE_DELAY")
+	if v == "" {
+		return p, nil
+	}
+	if strings.HasPrefix(strings.ToLower(v), "p") {
+		f, err := strconv.ParseFloat(v[1:], 64)
+		if err != nil || f <= 0 || f >= 100 {
+			return nil, fmt.Errorf("invalid GRPC_PING_HEDGE_DELAY %q: must be a duration or a percentile, e.g. p95", v)
+		}
+		p.percentile = f
+	} else {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid GRPC_PING_HEDGE_DELAY %q: must be a duration or a percentile, e.g. p95", v)
+		}
+		p.delay = d
+	}
+
+	p.maxAttempts = 2
+	if v := os.Getenv("GRPC_PING_HEDGE_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 {
+			return nil, fmt.Errorf("invalid GRPC_PING_HEDGE_MAX_ATTEMPTS %q: must be a number >= 2", v)
+		}
+		p.maxAttempts = n
+	}
+
+	return p, nil
+}
+
+// Enabled reports whether requests are hedged.
+func (p *hedgePolicy) Enabled() bool {
+	return p.maxAttempts > 1
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (p *hedgePolicy) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("max_attempts", p.maxAttempts)
+	if p.percentile > 0 {
+		enc.AddFloat64("percentile", p.percentile)
+	} else {
+		enc.AddDuration("delay", p.delay)
+	}
+	return nil
+}
+
+// hedgeDelay returns the delay before sending the next attempt.
+func (p *hedgePolicy) hedgeDelay() time.Duration {
+	if p.percentile == 0 {
+		return p.delay
+	}
+	if d, ok := p.latencies.percentile(p.percentile); ok {
+		return d
+	}
+	return defaultHedgeDelay
+}
+
+// Describe implements prometheus.Collector.
+func (p *hedgePolicy) Describe(ch chan<- *prometheus.Desc) {
+	p.hedges.Describe(ch)
+	p.wins.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (p *hedgePolicy) Collect(ch chan<- prometheus.Metric) {
+	p.hedges.Collect(ch)
+	p.wins.Collect(ch)
+}
+
+// hedged calls call according to p, see hedgePolicy. The attempts of call must return when their context is done.
+func hedged[T any](ctx context.Context, p *hedgePolicy, call func(ctx context.Context) (T, error)) (T, error) {
+	if !p.Enabled() {
+		return call(ctx)
+	}
+
+	// Cancel the attempts which lost.
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		attempt int
+		resp    T
+		err     error
+	}
+	results := make(chan result, p.maxAttempts)
+	send := func(attempt int) {
+		go func() {
+			start := time.Now()
+			resp, err := call(ctx)
+			if err == nil || (ctx.Err() != nil && parent.Err() == nil) {
+				p.latencies.add(time.Since(start))
+			}
+			results <- result{attempt: attempt, resp: resp, err: err}
+		}()
+	}
+
+	logger := zapcloudlogging.FromContext(ctx)
+	stats, _ := ctx.Value(hedgeStatsKey{}).(*hedgeStats)
+	delay := p.hedgeDelay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	send(1)
+	sent, inFlight := 1, 1
+	for {
+		select {
+		case <-timer.C:
+			sent++
+			inFlight++
+			logger.Debug("hedging upstream request", zap.Int("attempt", sent), zap.Duration("delay", delay))
+			p.hedges.WithLabelValues(strconv.Itoa(sent)).Inc()
+			stats.hedged()
+			send(sent)
+			if sent < p.maxAttempts {
+				timer.Reset(delay)
+			}
+
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				p.wins.WithLabelValues(strconv.Itoa(r.attempt)).Inc()
+				stats.won(r.attempt, delay)
+				return r.resp, nil
+			}
+			if inFlight == 0 {
+				return r.resp, r.err
+			}
+		}
+	}
+}
+
+// latencyWindow holds the latencies of the recent upstream requests.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < cap(w.samples) {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+// percentile returns the pct percentile of the latencies, and false if too few were measured.
+func (w *latencyWindow) percentile(pct float64) (time.Duration, bool) {
+	w.mu.Lock()
+	samples := append([]time.Duration(nil), w.samples...)
+	w.mu.Unlock()
+
+	if len(samples) < hedgeMinSamples {
+		return 0, false
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(pct / 100 * float64(len(samples)))
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i], true
+}
+
+type hedgeStatsKey struct{}
+
+// hedgeStats are the hedging statistics of a relayed request, over all of its retries.
+type hedgeStats struct {
+	mu sync.Mutex
+
+	// hedges is the number of hedged attempts sent, winner the number of the attempt which answered first and delay the
+	// hedging delay then.
+	hedges int
+	winner int
+	delay  time.Duration
+}
+
+// withHedgeStats returns a copy of ctx recording the hedging statistics of the upstream requests made with it,
+// and the statistics.
+func withHedgeStats(ctx context.Context) (context.Context, *hedgeStats) {
+	s := &hedgeStats{}
+	return context.WithValue(ctx, hedgeStatsKey{}, s), s
+}
+
+func (s *hedgeStats) hedged() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hedges++
+}
+
+func (s *hedgeStats) won(attempt int, delay time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.winner = attempt
+	s.delay = delay
+}
+
+// Hedges returns the number of hedged attempts sent.
+func (s *hedgeStats) Hedges() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hedges
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (s *hedgeStats) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc.AddInt("hedges", s.hedges)
+	if s.winner > 0 {
+		enc.AddInt("winner", s.winner)
+		enc.AddDuration("delay", s.delay)
+	}
+	return nil
+}
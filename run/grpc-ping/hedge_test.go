@@ -0,0 +1,207 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+)
+
+func TestHedgedSamplesLosers(t *testing.T) {
+	const delay = 20 * time.Millisecond
+
+	p := defaultHedgePolicy()
+	p.maxAttempts = 2
+	p.delay = delay
+
+	// The first attempt hangs until it is canceled, the hedged one answers right away.
+	var attempts atomic.Int32
+	call := func(ctx context.Context) (int, error) {
+		n := int(attempts.Add(1))
+		if n == 1 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return n, nil
+	}
+
+	ctx := zapcloudlogging.NewContext(context.Background(), zap.NewNop())
+	got, err := hedged(ctx, p, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2 {
+		t.Errorf("hedged() = %d, want the answer of attempt 2", got)
+	}
+
+	// The loser records its latency once it returned.
+	var samples []time.Duration
+	deadline := time.Now().Add(5 * time.Second)
+	for len(samples) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		p.latencies.mu.Lock()
+		samples = append(samples[:0], p.latencies.samples...)
+		p.latencies.mu.Unlock()
+	}
+	if len(samples) != 2 {
+		t.Fatalf("recorded %d latencies, want the winner and the loser", len(samples))
+	}
+	if samples[0] < delay && samples[1] < delay {
+		t.Errorf("latencies %v do not include the loser, which ran at least %v", samples, delay)
+	}
+}
+
+func TestHedgedMaxAttempts(t *testing.T) {
+	p := defaultHedgePolicy()
+	p.maxAttempts = 3
+	p.delay = time.Millisecond
+
+	// Every attempt fails after a while, long enough for all of them to be sent.
+	var attempts atomic.Int32
+	call := func(ctx context.Context) (int, error) {
+		attempts.Add(1)
+		select {
+		case <-ctx.Done():
+		case <-time.After(50 * time.Millisecond):
+		}
+		return 0, errors.New("upstream failed")
+	}
+
+	ctx := zapcloudlogging.NewContext(context.Background(), zap.NewNop())
+	if _, err := hedged(ctx, p, call); err == nil {
+		t.Fatal("hedged() succeeded, want the error of the attempts")
+	}
+	if got := attempts.Load(); got != int32(p.maxAttempts) {
+		t.Errorf("sent %d attempts, want %d", got, p.maxAttempts)
+	}
+}
+
+func TestHedgedAllFail(t *testing.T) {
+	const delay = time.Hour
+
+	p := defaultHedgePolicy()
+	p.maxAttempts = 2
+	p.delay = delay
+
+	var attempts atomic.Int32
+	call := func(ctx context.Context) (int, error) {
+		return 0, fmt.Errorf("attempt %d failed", attempts.Add(1))
+	}
+
+	ctx := zapcloudlogging.NewContext(context.Background(), zap.NewNop())
+	done := make(chan error, 1)
+	go func() {
+		_, err := hedged(ctx, p, call)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "attempt 1 failed" {
+			t.Errorf("hedged() = %v, want the error of the last attempt", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("hedged() waited for the delay of %v after every attempt failed", delay)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("sent %d attempts, want 1", got)
+	}
+}
+
+func TestHedgedFirstSuccessWins(t *testing.T) {
+	p := defaultHedgePolicy()
+	p.maxAttempts = 3
+	p.delay = 5 * time.Millisecond
+
+	// The last attempt answers right away, the others hang until they are canceled.
+	var attempts atomic.Int32
+	losers := make(chan error, p.maxAttempts)
+	call := func(ctx context.Context) (int, error) {
+		n := int(attempts.Add(1))
+		if n == p.maxAttempts {
+			return n, nil
+		}
+		<-ctx.Done()
+		losers <- ctx.Err()
+		return 0, ctx.Err()
+	}
+
+	ctx := zapcloudlogging.NewContext(context.Background(), zap.NewNop())
+	got, err := hedged(ctx, p, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != p.maxAttempts {
+		t.Errorf("hedged() = %d, want the answer of attempt %d", got, p.maxAttempts)
+	}
+	for i := 1; i < p.maxAttempts; i++ {
+		select {
+		case err := <-losers:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("context of a losing attempt = %v, want canceled", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("losing attempts not canceled")
+		}
+	}
+}
+
+func TestHedgeDelay(t *testing.T) {
+	p := defaultHedgePolicy()
+	p.maxAttempts = 2
+	p.percentile = 50
+
+	for i := 0; i < hedgeMinSamples-1; i++ {
+		p.latencies.add(10 * time.Millisecond)
+	}
+	if got := p.hedgeDelay(); got != defaultHedgeDelay {
+		t.Errorf("hedgeDelay() with %d latencies = %v, want the default %v", hedgeMinSamples-1, got, defaultHedgeDelay)
+	}
+	p.latencies.add(10 * time.Millisecond)
+	if got, want := p.hedgeDelay(), 10*time.Millisecond; got != want {
+		t.Errorf("hedgeDelay() with %d latencies = %v, want %v", hedgeMinSamples, got, want)
+	}
+}
+
+func TestLatencyWindowPercentile(t *testing.T) {
+	w := &latencyWindow{samples: make([]time.Duration, 0, hedgeLatencySamples)}
+	// 100ms down to 1ms, so the window sorts them.
+	for i := 100; i > 0; i-- {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		pct  float64
+		want time.Duration
+	}{
+		{50, 51 * time.Millisecond},
+		{99, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got, ok := w.percentile(tt.pct)
+		if !ok {
+			t.Fatalf("percentile(%v) not available with 100 latencies", tt.pct)
+		}
+		if got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.pct, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	logtypepb "google.golang.org/genproto/googleapis/logging/type"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// requestIDHeader carries the ID of a request, generated by the server if the caller did not set it.
+const requestIDHeader = "x-request-id"
+
+// requestLogging gives every RPC a request-scoped logger, stored in its context with zapcloudlogging.NewContext, and
+// logs one completion entry per RPC with its status code, duration and sizes in the Cloud Logging httpRequest field.
+type requestLogging struct {
+	logger *zap.Logger
+
+	// projectID is the project of the traces the log entries are correlated with, see withIncomingTrace.
+	projectID string
+
+	// payloadLimit is the number of bytes of the request and response payloads logged, they are not logged if 0.
+	payloadLimit int
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor that provides reporting for Unary RPCs.
+func (l *requestLogging) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, rl := l.start(ctx, protocolGRPC, info.FullMethod, grpcPeer(ctx), false)
+		rl.received(req)
+
+		resp, err := handler(ctx, req)
+		if err == nil {
+			rl.sent(resp)
+		}
+		rl.end(status.Code(err), err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is a gRPC server-side interceptor that provides reporting for Streaming RPCs.
+func (l *requestLogging) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, rl := l.start(ss.Context(), protocolGRPC, info.FullMethod, grpcPeer(ss.Context()), true)
+
+		err := handler(srv, &loggingServerStream{ServerStream: &serverStream{ServerStream: ss, ctx: ctx}, log: rl})
+		rl.end(status.Code(err), err)
+
+		return err
+	}
+}
+
+// ConnectInterceptor is a Connect handler interceptor that provides reporting for RPCs.
+func (l *requestLogging) ConnectInterceptor() connect.Interceptor {
+	return connectLogging{l}
+}
+
+// connectLogging implements requestLogging.ConnectInterceptor. It cannot use connectInterceptorFunc which does
+// not give access to the messages.
+type connectLogging struct {
+	*requestLogging
+}
+
+// WrapUnary implements connect.Interceptor.
+func (l connectLogging) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		ctx, rl := l.start(ctx, protocolConnect, req.Spec().Procedure, req.Peer().Addr, false)
+		rl.received(req.Any())
+
+		resp, err := next(ctx, req)
+		if err == nil {
+			rl.sent(resp.Any())
+		}
+		rl.end(connectCode(err), err)
+
+		return resp, err
+	}
+}
+
+// WrapStreamingClient implements connect.Interceptor. connectLogging only applies to handlers.
+func (l connectLogging) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements connect.Interceptor.
+func (l connectLogging) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, rl := l.start(ctx, protocolConnect, conn.Spec().Procedure, conn.Peer().Addr, true)
+
+		err := next(ctx, &loggingHandlerConn{StreamingHandlerConn: conn, log: rl})
+		rl.end(connectCode(err), err)
+
+		return err
+	}
+}
+
+// start returns ctx carrying the request-scoped logger of the RPC method, and the rpcLog to report its messages
+// and completion to.
+func (l *requestLogging) start(ctx context.Context, protocol, method, peerAddr string, stream bool) (context.Context, *rpcLog) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestID := firstValue(md, requestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	ctx, logger := withIncomingTrace(ctx, l.logger, l.projectID)
+	fields := []zap.Field{
+		zap.String("protocol", protocol),
+		zap.String("method", method),
+		zap.String("peer", peerAddr),
+		zap.String("request_id", requestID),
+	}
+	// Cloud Run and the gateway append the address of their client to X-Forwarded-For, after the hops the client sent
+	// itself. Any caller controls these, so log the whole chain next to the peer rather than trusting one of them.
+	if v := md.Get("x-forwarded-for"); len(v) > 0 {
+		fields = append(fields, zap.String("forwarded_for", strings.Join(v, ", ")))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		fields = append(fields, zap.Time("deadline", deadline))
+	}
+
+	rl := &rpcLog{
+		logger:       logger.With(fields...),
+		start:        time.Now(),
+		method:       method,
+		remoteIP:     peerAddr,
+		userAgent:    firstValue(md, "user-agent"),
+		stream:       stream,
+		payloadLimit: l.payloadLimit,
+	}
+	ctx = context.WithValue(ctx, rpcLogKey{}, rl)
+
+	return zapcloudlogging.NewContext(ctx, rl.logger), rl
+}
+
+// rpcLog is the request-scoped log state of an RPC.
+type rpcLog struct {
+	logger       *zap.Logger
+	start        time.Time
+	method       string
+	remoteIP     string
+	userAgent    string
+	stream       bool
+	payloadLimit int
+
+	requestSize, responseSize       atomic.Int64
+	requestCount, responseCount     atomic.Int64
+	requestPayload, responsePayload string
+
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
+type rpcLogKey struct{}
+
+// withLogFields returns a copy of ctx whose request-scoped logger carries fields. They are added to the completion
+// entry of the RPC too, e.g. the caller verified by an interceptor running after requestLogging.
+func withLogFields(ctx context.Context, fields ...zap.Field) context.Context {
+	if rl, ok := ctx.Value(rpcLogKey{}).(*rpcLog); ok {
+		rl.mu.Lock()
+		rl.fields = append(rl.fields, fields...)
+		rl.mu.Unlock()
+	}
+	return zapcloudlogging.NewContext(ctx, zapcloudlogging.FromContext(ctx).With(fields...))
+}
+
+// received records a message received from the client.
+func (rl *rpcLog) received(m interface{}) {
+	rl.requestCount.Add(1)
+	rl.requestSize.Add(int64(messageSize(m)))
+	if rl.payloadLimit > 0 {
+		payload := rl.payload(m)
+		if rl.stream {
+			rl.logger.Debug("received message", zap.String("payload", payload))
+		} else {
+			rl.requestPayload = payload
+		}
+	}
+}
+
+// sent records a message sent to the client.
+func (rl *rpcLog) sent(m interface{}) {
+	rl.responseCount.Add(1)
+	rl.responseSize.Add(int64(messageSize(m)))
+	if rl.payloadLimit > 0 {
+		payload := rl.payload(m)
+		if rl.stream {
+			rl.logger.Debug("sent message", zap.String("payload", payload))
+		} else {
+			rl.responsePayload = payload
+		}
+	}
+}
+
+// payload returns m in JSON, truncated to payloadLimit bytes.
+func (rl *rpcLog) payload(m interface{}) string {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return fmt.Sprintf("<%T>", m)
+	}
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Sprintf("<%T: %v>", m, err)
+	}
+	if len(b) > rl.payloadLimit {
+		return fmt.Sprintf("%s... (%d bytes truncated)", b[:rl.payloadLimit], len(b)-rl.payloadLimit)
+	}
+	return string(b)
+}
+
+// end logs the completion entry of the RPC, which ended with code and err.
+func (rl *rpcLog) end(code codes.Code, err error) {
+	latency := time.Since(rl.start)
+
+	rl.mu.Lock()
+	fields := append([]zap.Field{}, rl.fields...)
+	rl.mu.Unlock()
+	fields = append(fields,
+		zapcloudlogging.HTTP(&zapcloudlogging.HTTPPayload{HttpRequest: &logtypepb.HttpRequest{
+			RequestMethod: "POST",
+			RequestUrl:    rl.method,
+			RequestSize:   rl.requestSize.Load(),
+			ResponseSize:  rl.responseSize.Load(),
+			Status:        int32(runtime.HTTPStatusFromCode(code)),
+			UserAgent:     rl.userAgent,
+			RemoteIp:      rl.remoteIP,
+			Latency:       durationpb.New(latency),
+		}}),
+		zap.Stringer("code", code),
+		zap.Duration("duration", latency),
+	)
+	if rl.stream {
+		fields = append(fields, zap.Int64("messages_received", rl.requestCount.Load()), zap.Int64("messages_sent", rl.responseCount.Load()))
+	}
+	if rl.requestPayload != "" {
+		fields = append(fields, zap.String("request", rl.requestPayload))
+	}
+	if rl.responsePayload != "" {
+		fields = append(fields, zap.String("response", rl.responsePayload))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+
+	rl.logger.Check(completionLevel(code), "finished call").Write(fields...)
+}
+
+// completionLevel returns the severity of the completion entry of an RPC which ended with code:
+// errors of the server are logged as errors, errors of the client or the upstream service as warnings.
+func completionLevel(code codes.Code) zapcore.Level {
+	switch code {
+	case codes.OK:
+		return zapcore.InfoLevel
+	case codes.Unknown, codes.Internal, codes.Unimplemented, codes.DataLoss:
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.WarnLevel
+	}
+}
+
+// loggingServerStream wraps grpc.ServerStream to record the streamed messages.
+type loggingServerStream struct {
+	grpc.ServerStream
+	log *rpcLog
+}
+
+// RecvMsg implements grpc.ServerStream.
+func (s *loggingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.log.received(m)
+	}
+	return err
+}
+
+// SendMsg implements grpc.ServerStream.
+func (s *loggingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.log.sent(m)
+	}
+	return err
+}
+
+// loggingHandlerConn wraps connect.StreamingHandlerConn to record the streamed messages.
+type loggingHandlerConn struct {
+	connect.StreamingHandlerConn
+	log *rpcLog
+}
+
+// Receive implements connect.StreamingHandlerConn.
+func (c *loggingHandlerConn) Receive(m any) error {
+	err := c.StreamingHandlerConn.Receive(m)
+	if err == nil {
+		c.log.received(m)
+	}
+	return err
+}
+
+// Send implements connect.StreamingHandlerConn.
+func (c *loggingHandlerConn) Send(m any) error {
+	err := c.StreamingHandlerConn.Send(m)
+	if err == nil {
+		c.log.sent(m)
+	}
+	return err
+}
+
+// grpcPeer returns the address of the client of the gRPC call of ctx.
+func grpcPeer(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// messageSize returns the encoded size of m, 0 if it is not a protobuf message.
+func messageSize(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok {
+		return proto.Size(msg)
+	}
+	return 0
+}
+
+// firstValue returns the first value of key in md, or "".
+func firstValue(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
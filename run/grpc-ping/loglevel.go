@@ -0,0 +1,183 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// defaultLogLevel is the level of logger when the LOG_LEVEL environment variable is not set.
+const defaultLogLevel = zapcore.InfoLevel
+
+// logLevel is the level of logger, and of the request-scoped loggers derived from it.
+var logLevel = zap.NewAtomicLevelAt(defaultLogLevel)
+
+// logLevelAdmin serves the level of logger over HTTP, so it can be changed on a live instance:
+//
+//	GET  returns {"level": "info"}, and the time the level reverts at, if any.
+//	PUT  sets the level from {"level": "debug", "duration": "15m"}. It reverts to the startup level after duration,
+//	     if set. POST is accepted too.
+//
+// Callers must present an ID token accepted by verifier in the Authorization header.
+type logLevelAdmin struct {
+	level    zap.AtomicLevel
+	verifier *idTokenVerifier
+
+	// initial is the level logLevelAdmin reverts to, LOG_LEVEL.
+	initial zapcore.Level
+
+	mu       sync.Mutex
+	revert   *time.Timer
+	revertAt time.Time
+
+	// generation identifies the last change, so a timer of an earlier change which fired concurrently does not revert it.
+	generation int
+}
+
+func newLogLevelAdmin(level zap.AtomicLevel, verifier *idTokenVerifier) *logLevelAdmin {
+	return &logLevelAdmin{
+		level:    level,
+		verifier: verifier,
+		initial:  level.Level(),
+	}
+}
+
+// logLevelPayload is the JSON body of the logLevelAdmin requests and responses.
+type logLevelPayload struct {
+	Level    string     `json:"level"`
+	Duration string     `json:"duration,omitempty"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// ServeHTTP implements http.Handler.
+func (a *logLevelAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Verify the token like the interceptors do, from the incoming metadata.
+	ctx := metadata.NewIncomingContext(r.Context(), metadata.Pairs("authorization", r.Header.Get("Authorization")))
+	email, err := a.verifier.Verify(ctx)
+	if err != nil {
+		logger.Warn("rejected admin request", zap.String("path", r.URL.Path), zap.Error(err))
+		http.Error(w, status.Convert(err).Message(), runtime.HTTPStatusFromCode(status.Code(err)))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req logLevelPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := a.set(req.Level, req.Duration, email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.payload())
+}
+
+// set sets the level to text, reverting to the initial level after duration if not empty. caller requested the change.
+func (a *logLevelAdmin) set(text, duration, caller string) error {
+	if text == "" {
+		return fmt.Errorf("missing level")
+	}
+	level, err := zapcore.ParseLevel(text)
+	if err != nil {
+		return err
+	}
+	var d time.Duration
+	if duration != "" {
+		d, err = time.ParseDuration(duration)
+		if err != nil {
+			return fmt.Errorf("invalid duration: %w", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("invalid duration: %s is negative", duration)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.generation++
+	if a.revert != nil {
+		a.revert.Stop()
+		a.revert = nil
+		a.revertAt = time.Time{}
+	}
+	if d > 0 {
+		generation := a.generation
+		a.revertAt = time.Now().Add(d)
+		a.revert = time.AfterFunc(d, func() { a.reset(generation) })
+	}
+
+	// Log at the more verbose of both levels, so the entry is not filtered out.
+	from := a.level.Level()
+	if level < from {
+		a.level.SetLevel(level)
+	}
+	logger.Info("changed log level", zap.Stringer("from", from), zap.Stringer("to", level),
+		zap.Duration("duration", d), zap.String("caller", caller))
+	a.level.SetLevel(level)
+
+	return nil
+}
+
+// reset reverts the level to the initial one, unless it changed again since generation.
+func (a *logLevelAdmin) reset(generation int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if generation != a.generation {
+		return
+	}
+
+	from := a.level.Level()
+	if a.initial < from {
+		a.level.SetLevel(a.initial)
+	}
+	logger.Info("reverted log level", zap.Stringer("from", from), zap.Stringer("to", a.initial))
+	a.level.SetLevel(a.initial)
+	a.revert = nil
+	a.revertAt = time.Time{}
+}
+
+func (a *logLevelAdmin) payload() logLevelPayload {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p := logLevelPayload{Level: a.level.Level().String()}
+	if a.revert != nil {
+		revertAt := a.revertAt
+		p.RevertAt = &revertAt
+	}
+	return p
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newTestLogLevelAdmin returns a logLevelAdmin of a level starting at info.
+func newTestLogLevelAdmin(t *testing.T) *logLevelAdmin {
+	t.Helper()
+
+	return newLogLevelAdmin(zap.NewAtomicLevelAt(zapcore.InfoLevel), nil)
+}
+
+func TestLogLevelAdminSetInvalid(t *testing.T) {
+	a := newTestLogLevelAdmin(t)
+
+	for _, tt := range []struct{ level, duration string }{
+		{"", ""},
+		{"verbose", ""},
+		{"debug", "soon"},
+		{"debug", "-5m"},
+	} {
+		if err := a.set(tt.level, tt.duration, testEmail); err == nil {
+			t.Errorf("set(%q, %q) succeeded, want an error", tt.level, tt.duration)
+		}
+	}
+	if got := a.level.Level(); got != zapcore.InfoLevel {
+		t.Errorf("level = %v, want unchanged info", got)
+	}
+	if p := a.payload(); p.RevertAt != nil {
+		t.Errorf("revert at %v, want none", p.RevertAt)
+	}
+}
+
+func TestLogLevelAdminRevert(t *testing.T) {
+	a := newTestLogLevelAdmin(t)
+
+	if err := a.set("debug", "10ms", testEmail); err != nil {
+		t.Fatal(err)
+	}
+	if p := a.payload(); p.Level != "debug" || p.RevertAt == nil {
+		t.Errorf("payload = %+v, want debug with a revert time", p)
+	}
+	waitFor(t, func() bool { return a.level.Level() == zapcore.InfoLevel })
+	if p := a.payload(); p.RevertAt != nil {
+		t.Errorf("revert at %v after reverting, want none", p.RevertAt)
+	}
+}
+
+func TestLogLevelAdminGeneration(t *testing.T) {
+	a := newTestLogLevelAdmin(t)
+
+	if err := a.set("debug", "10ms", testEmail); err != nil {
+		t.Fatal(err)
+	}
+	a.mu.Lock()
+	generation := a.generation
+	a.mu.Unlock()
+	if err := a.set("warn", "", testEmail); err != nil {
+		t.Fatal(err)
+	}
+
+	// The timer of the first change may have fired before set stopped it, and run reset concurrently.
+	a.reset(generation)
+	time.Sleep(50 * time.Millisecond)
+	if got := a.level.Level(); got != zapcore.WarnLevel {
+		t.Errorf("level = %v after an earlier timer fired, want warn", got)
+	}
+}
@@ -20,102 +20,103 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"cloud.google.com/go/compute/metadata"
+	"github.com/bufbuild/connect-go"
 	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
 )
 
-// conn holds an open connection to the ping service.
-var conn *grpc.ClientConn
+var logger *zap.Logger
 
-var logger = zap.New(zapcloudlogging.NewCore(zapcore.Lock(os.Stdout), zap.NewAtomicLevelAt(zapcore.DebugLevel).Level()))
+// mdp provides the instance metadata, selected by the GRPC_PING_METADATA environment variable.
+var mdp metadataProvider
 
 func init() {
-	ctx := context.Background()
-	ctx = zapcloudlogging.NewContext(ctx, logger)
-	if os.Getenv("GRPC_PING_HOST") != "" {
-		var err error
-		conn, err = NewConn(ctx, os.Getenv("GRPC_PING_HOST"), os.Getenv("GRPC_PING_INSECURE") != "")
+	// The metadata provider must be ready before the logger, which detects the Cloud Run resource through it.
+	var mdpErr error
+	mdp, mdpErr = newMetadataProvider(os.Getenv("GRPC_PING_METADATA"))
+
+	// LOG_LEVEL is parsed once the logger exists to report errors, logLevel keeps defaultLogLevel until then.
+	level := logLevel
+	if _, static := mdp.(staticMetadataProvider); static || mdpErr != nil {
+		// Without a metadata server zapcloudlogging cannot detect the Cloud Run resource, log plain JSON instead.
+		logger = zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.Lock(os.Stdout), level))
+	} else {
+		logger = zap.New(zapcloudlogging.NewCore(zapcore.Lock(os.Stdout), level))
+	}
+	if mdpErr != nil {
+		logger.Fatal("failed to newMetadataProvider", zap.Error(mdpErr))
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		l, err := zapcore.ParseLevel(v)
 		if err != nil {
-			logger.Fatal("failed to NewConn", zap.Error(err))
+			logger.Fatal("invalid LOG_LEVEL", zap.String("value", v), zap.Error(err))
 		}
-	} else {
-		logger.Info("Starting without support for SendUpstream: configure with 'GRPC_PING_HOST' environment variable. E.g., example.com:443")
+		logLevel.SetLevel(l)
 	}
-}
-
-const (
-	// Project ID of the project the Cloud Run service or job belongs to
-	projectProjectID = "project/project-id"
-
-	// Project number of the project the Cloud Run service or job belongs to
-	projectNumericProjectID = "project/numeric-project-id"
-
-	// Region of this Cloud Run service or job, returns projects/PROJECT-NUMBER/regions/REGION
-	instanceRegion = "instance/region"
-
-	// Unique identifier of the container instance (also available in logs).
-	instanceID = "instance/id"
-
-	// Email for the runtime service account of this Cloud Run service or job.
-	instanceSADefaultEmail = "instance/service-accounts/default/email"
-
-	// Generates an OAuth2 access token for the service account of this Cloud Run service or job. The Cloud Run service agent is used to fetch a token. This endpoint will return a JSON response with an access_token attribute. Read more about how to extract and use this access token.
-	instanceSADefaultToken = "instance/service-accounts/default/token"
-)
-
-func fetchMetadata(mdc *metadata.Client, logger *zap.Logger) {
-	projectID, err := mdc.Get(projectProjectID)
-	if err != nil {
-		logger.Fatal("could not get project id from /computeMetadata/v1/project/project-id endpoint", zap.Error(err))
+	if fakeMetadata != nil {
+		logger.Info("serving fake metadata: configure with 'GRPC_PING_METADATA' environment variable", zap.String("host", fakeMetadata.Host()))
 	}
 
-	numericProjectID, err := mdc.Get(projectNumericProjectID)
-	if err != nil {
-		logger.Fatal("could not get numeric project id from /computeMetadata/v1/project/numeric-project-id endpoint", zap.Error(err))
-	}
+	ctx := context.Background()
+	ctx = zapcloudlogging.NewContext(ctx, logger)
 
-	region, err := mdc.Get(instanceRegion)
+	// Tracing must be set up before NewConn, whose interceptors propagate the trace context upstream.
+	exporter := os.Getenv("GRPC_PING_TRACE_EXPORTER")
+	var err error
+	tracerProvider, err = setupTracing(ctx, exporter, os.Getenv("GRPC_PING_TRACE_FILE"))
 	if err != nil {
-		logger.Fatal("could not get project id from /computeMetadata/v1/project/project-id endpoint", zap.Error(err))
+		logger.Fatal("failed to setupTracing", zap.Error(err))
 	}
-
-	id, err := mdc.Get(instanceID)
-	if err != nil {
-		logger.Fatal("could not get project id from /computeMetadata/v1/project/project-id endpoint", zap.Error(err))
+	if tracerProvider != nil {
+		logger.Info("exporting traces", zap.String("exporter", exporter))
 	}
 
-	saDefaultEmail, err := mdc.Get(instanceSADefaultEmail)
+	upstreams, err = upstreamsFromEnv()
 	if err != nil {
-		logger.Fatal("could not get project id from /computeMetadata/v1/project/project-id endpoint", zap.Error(err))
+		logger.Fatal("failed to upstreamsFromEnv", zap.Error(err))
 	}
+	if len(upstreams) > 0 {
+		upstreamRetry, err = retryPolicyFromEnv()
+		if err != nil {
+			logger.Fatal("failed to retryPolicyFromEnv", zap.Error(err))
+		}
+		logger.Info("retrying upstream requests", zap.Object("retry_policy", upstreamRetry))
+		upstreamHedge, err = hedgePolicyFromEnv()
+		if err != nil {
+			logger.Fatal("failed to hedgePolicyFromEnv", zap.Error(err))
+		}
+		if upstreamHedge.Enabled() {
+			logger.Info("hedging upstream requests", zap.Object("hedge_policy", upstreamHedge))
+		}
 
-	saDefaultToken, err := mdc.Get(instanceSADefaultToken)
-	if err != nil {
-		logger.Fatal("could not get project id from /computeMetadata/v1/project/project-id endpoint", zap.Error(err))
+		for _, u := range upstreams {
+			if err := u.Dial(ctx); err != nil {
+				logger.Fatal("failed to Dial upstream", zap.String("upstream", u.name), zap.Error(err))
+			}
+			logger.Info("relaying to upstream", zap.Object("upstream", u))
+		}
+	} else {
+		logger.Info("Starting without support for SendUpstream: configure with 'GRPC_PING_HOST' or 'GRPC_PING_UPSTREAMS' environment variable. E.g., example.com:443")
 	}
-
-	logger.Info("metadata",
-		zap.String(projectProjectID, projectID),
-		zap.String(projectNumericProjectID, numericProjectID),
-		zap.String(instanceRegion, region),
-		zap.String(instanceID, id),
-		zap.String(instanceSADefaultEmail, saDefaultEmail),
-		zap.String(instanceSADefaultToken, saDefaultToken),
-	)
 }
 
 func main() {
 	logger.Info("grpc-ping: starting server...")
 
 	logger.Info("get metadata from metadata server")
-	mdc := metadata.NewClient(http.DefaultClient)
-	fetchMetadata(mdc, logger)
+	info := fetchMetadata(mdp, logger)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -128,16 +129,153 @@ func main() {
 		logger.Fatal("net.Listen", zap.Error(err))
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	drainTimeout := defaultDrainTimeout
+	if v := os.Getenv("GRPC_PING_DRAIN_TIMEOUT"); v != "" {
+		drainTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			logger.Fatal("invalid GRPC_PING_DRAIN_TIMEOUT", zap.String("value", v), zap.Error(err))
+		}
+	}
+
+	// Cloud Run sends SIGTERM before stopping an instance.
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer cancel()
 
 	ctx = zapcloudlogging.NewContext(ctx, logger)
 
-	gsrv := grpc.NewServer(grpc.ChainUnaryInterceptor(
-		UnaryServerInterceptor(logger)),
+	// Log request and response payloads, truncated to GRPC_PING_LOG_PAYLOAD bytes, only if asked to.
+	var payloadLimit int
+	if v := os.Getenv("GRPC_PING_LOG_PAYLOAD"); v != "" {
+		payloadLimit, err = strconv.Atoi(v)
+		if err != nil || payloadLimit < 0 {
+			logger.Fatal("invalid GRPC_PING_LOG_PAYLOAD: must be a number of bytes", zap.String("value", v))
+		}
+	}
+	logging := &requestLogging{logger: logger, projectID: info.ProjectID, payloadLimit: payloadLimit}
+	// Recover panics within the logging interceptors, so they are reported with the request-scoped logger.
+	recovery := &panicRecovery{service: info.Service, version: info.Revision}
+
+	tracker := &requestTracker{}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		otelgrpc.UnaryServerInterceptor(),
+		tracker.UnaryServerInterceptor(),
+		metrics.UnaryServerInterceptor(),
+		logging.UnaryServerInterceptor(),
+		recovery.UnaryServerInterceptor(),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		otelgrpc.StreamServerInterceptor(),
+		tracker.StreamServerInterceptor(),
+		metrics.StreamServerInterceptor(),
+		logging.StreamServerInterceptor(),
+		recovery.StreamServerInterceptor(),
+	}
+	connectInterceptors := []connect.Interceptor{
+		TracingConnectInterceptor(),
+		tracker.ConnectInterceptor(),
+		metrics.ConnectInterceptor(),
+		logging.ConnectInterceptor(),
+		recovery.ConnectInterceptor(),
+	}
+
+	var jwks []byte
+	if path := os.Getenv("GRPC_PING_AUTH_JWKS_FILE"); path != "" {
+		jwks, err = os.ReadFile(path)
+		if err != nil {
+			logger.Fatal("could not read JWKS file", zap.String("path", path), zap.Error(err))
+		}
+	}
+	if audience := os.Getenv("GRPC_PING_AUTH_AUDIENCE"); audience != "" {
+		allowedEmails := splitList(os.Getenv("GRPC_PING_AUTH_ALLOWED_EMAILS"))
+
+		verifier, err := newIDTokenVerifier(ctx, audience, allowedEmails, jwks)
+		if err != nil {
+			logger.Fatal("failed to newIDTokenVerifier", zap.Error(err))
+		}
+		unaryInterceptors = append(unaryInterceptors, verifier.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, verifier.StreamServerInterceptor())
+		connectInterceptors = append(connectInterceptors, verifier.ConnectInterceptor())
+		logger.Info("verifying ID tokens of incoming requests", zap.String("audience", audience), zap.Strings("allowed_emails", allowedEmails))
+	}
+
+	gsrv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
 	)
-	pb.RegisterPingServiceServer(gsrv, &pingService{})
-	if err = gsrv.Serve(listener); err != nil {
+	svc := &pingService{info: info.Proto()}
+	pb.RegisterPingServiceServer(gsrv, svc)
+
+	healthChecker := newHealthChecker()
+	healthChecker.Register(gsrv)
+
+	// Let clients discover the services without their proto files, e.g. with grpcurl or the client's -list and -invoke flags.
+	reflection.Register(gsrv)
+	if u := primaryUpstream(); u != nil {
+		go healthChecker.WatchUpstream(ctx, u.conn)
+		u.breaker.OnStateChange(healthChecker.SetCircuitState)
+	}
+
+	gateway, err := newGatewayHandler(ctx, svc, unaryInterceptors...)
+	if err != nil {
+		logger.Fatal("failed to newGatewayHandler", zap.Error(err))
+	}
+	// Let browsers call the server with gRPC-Web, from the origins of GRPC_PING_CORS_ORIGINS.
+	cors := corsPolicy{
+		origins:       splitList(os.Getenv("GRPC_PING_CORS_ORIGINS")),
+		headers:       splitList(os.Getenv("GRPC_PING_CORS_HEADERS")),
+		exposeHeaders: splitList(os.Getenv("GRPC_PING_CORS_EXPOSE_HEADERS")),
+	}
+	grpcWeb := newGRPCWebServer(gsrv, cors)
+	logger.Info("serving gRPC-Web", zap.Strings("cors_origins", cors.origins), zap.Strings("cors_headers", cors.headers), zap.Strings("cors_expose_headers", cors.exposeHeaders))
+
+	// Serve PingService over the Connect protocol too, the metrics for scrapers and the admin endpoints if enabled.
+	// The gateway serves the other paths.
+	mux := http.NewServeMux()
+	mux.Handle(newConnectHandler(svc, connectInterceptors...))
+	mux.Handle("/metrics", newMetricsHandler())
+	if admins := splitList(os.Getenv("GRPC_PING_ADMIN_EMAILS")); len(admins) > 0 {
+		audience := os.Getenv("GRPC_PING_ADMIN_AUDIENCE")
+		if audience == "" {
+			audience = os.Getenv("GRPC_PING_AUTH_AUDIENCE")
+		}
+		if audience == "" {
+			logger.Fatal("GRPC_PING_ADMIN_EMAILS requires GRPC_PING_ADMIN_AUDIENCE or GRPC_PING_AUTH_AUDIENCE")
+		}
+		adminVerifier, err := newIDTokenVerifier(ctx, audience, admins, jwks)
+		if err != nil {
+			logger.Fatal("failed to newIDTokenVerifier", zap.Error(err))
+		}
+		mux.Handle("/admin/loglevel", newLogLevelAdmin(logLevel, adminVerifier))
+		logger.Info("serving /admin/loglevel", zap.String("audience", audience), zap.Strings("admin_emails", admins))
+	}
+	mux.Handle("/", gateway)
+
+	// Serve gRPC-Web, Connect and the REST/JSON gateway next to gRPC on the same port.
+	httpSrv, err := newHTTPServer(newHTTPHandler(gsrv, grpcWeb, mux))
+	if err != nil {
+		logger.Fatal("failed to newHTTPServer", zap.Error(err))
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpSrv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
 		logger.Fatal("could not serve", zap.Error(err))
+	case <-ctx.Done():
+		shutdown(gsrv, httpSrv, healthChecker, tracker, drainTimeout)
+	}
+}
+
+// splitList splits a comma-separated environment variable value, dropping empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
 	}
+	return list
 }
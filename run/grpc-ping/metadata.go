@@ -0,0 +1,196 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+)
+
+const (
+	// Project ID of the project the Cloud Run service or job belongs to
+	projectProjectID = "project/project-id"
+
+	// Project number of the project the Cloud Run service or job belongs to
+	projectNumericProjectID = "project/numeric-project-id"
+
+	// Region of this Cloud Run service or job, returns projects/PROJECT-NUMBER/regions/REGION
+	instanceRegion = "instance/region"
+
+	// Unique identifier of the container instance (also available in logs).
+	instanceID = "instance/id"
+
+	// Email for the runtime service account of this Cloud Run service or job.
+	instanceSADefaultEmail = "instance/service-accounts/default/email"
+
+	// OAuth2 scopes granted to the runtime service account, one per line.
+	instanceSADefaultScopes = "instance/service-accounts/default/scopes"
+
+	// Generates an OAuth2 access token for the service account of this Cloud Run service or job. The Cloud Run service agent is used to fetch a token. This endpoint will return a JSON response with an access_token attribute. Read more about how to extract and use this access token.
+	instanceSADefaultToken = "instance/service-accounts/default/token"
+
+	// Generates an ID token for the service account of this Cloud Run service or job, given an audience query parameter.
+	instanceSADefaultIdentity = "instance/service-accounts/default/identity"
+)
+
+// secretMetadataKeys are the metadata keys whose values are credentials.
+// Their values are never logged, see metadataField.
+var secretMetadataKeys = []string{
+	instanceSADefaultToken,
+	instanceSADefaultIdentity,
+}
+
+// redacted replaces the value of secret metadata keys in logs.
+const redacted = "[REDACTED]"
+
+// metadataField returns a zap.Field logging the value of the metadata key, redacted if the key is secret.
+func metadataField(key, value string) zap.Field {
+	for _, secret := range secretMetadataKeys {
+		// Keys may carry query parameters, e.g. instance/service-accounts/default/identity?audience=...
+		if key == secret || strings.HasPrefix(key, secret+"?") {
+			return zap.String(key, redacted)
+		}
+	}
+	return zap.String(key, value)
+}
+
+// serviceAccountToken is the JSON response of the instance/service-accounts/default/token endpoint.
+type serviceAccountToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+
+	// Expiry is computed from ExpiresIn when the token is parsed.
+	Expiry time.Time `json:"-"`
+}
+
+// parseServiceAccountToken parses the JSON response of the instance/service-accounts/default/token endpoint.
+func parseServiceAccountToken(data string) (*serviceAccountToken, error) {
+	var tok serviceAccountToken
+	if err := json.Unmarshal([]byte(data), &tok); err != nil {
+		return nil, err
+	}
+	tok.Expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+
+	return &tok, nil
+}
+
+var _ zapcore.ObjectMarshaler = (*serviceAccountToken)(nil)
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+//
+// It describes the token without the access token itself.
+func (t *serviceAccountToken) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("token_type", t.TokenType)
+	enc.AddTime("expiry", t.Expiry)
+	enc.AddDuration("expires_in", time.Duration(t.ExpiresIn)*time.Second)
+	return nil
+}
+
+// MetadataInfo identifies the instance the server runs on.
+type MetadataInfo struct {
+	ProjectID           string
+	NumericProjectID    string
+	Region              string
+	InstanceID          string
+	ServiceAccountEmail string
+
+	// Service, Revision and Configuration come from the K_SERVICE, K_REVISION and K_CONFIGURATION
+	// environment variables of the Cloud Run container contract.
+	Service       string
+	Revision      string
+	Configuration string
+}
+
+// Proto returns info as a ServerInfo message.
+func (info *MetadataInfo) Proto() *pb.ServerInfo {
+	return &pb.ServerInfo{
+		ProjectId:           info.ProjectID,
+		NumericProjectId:    info.NumericProjectID,
+		Region:              info.Region,
+		InstanceId:          info.InstanceID,
+		ServiceAccountEmail: info.ServiceAccountEmail,
+		Service:             info.Service,
+		Revision:            info.Revision,
+		Configuration:       info.Configuration,
+	}
+}
+
+// fetchMetadata collects the MetadataInfo of the instance and logs a report of its metadata at startup.
+// Keys which cannot be looked up are reported as warnings and left empty.
+func fetchMetadata(mdp metadataProvider, logger *zap.Logger) *MetadataInfo {
+	get := func(key string) (string, bool) {
+		v, err := mdp.Get(key)
+		if err != nil {
+			logger.Warn("could not get metadata from /computeMetadata/v1/"+key+" endpoint", zap.Error(err))
+			return "", false
+		}
+		return v, true
+	}
+
+	info := &MetadataInfo{
+		Service:       os.Getenv("K_SERVICE"),
+		Revision:      os.Getenv("K_REVISION"),
+		Configuration: os.Getenv("K_CONFIGURATION"),
+	}
+
+	var fields []zap.Field
+	for _, md := range []struct {
+		key   string
+		field *string
+	}{
+		{projectProjectID, &info.ProjectID},
+		{projectNumericProjectID, &info.NumericProjectID},
+		{instanceRegion, &info.Region},
+		{instanceID, &info.InstanceID},
+		{instanceSADefaultEmail, &info.ServiceAccountEmail},
+	} {
+		if v, ok := get(md.key); ok {
+			*md.field = v
+			fields = append(fields, metadataField(md.key, v))
+		}
+	}
+	// instance/region is of the form projects/PROJECT-NUMBER/regions/REGION.
+	info.Region = info.Region[strings.LastIndex(info.Region, "/")+1:]
+
+	if v, ok := get(instanceSADefaultScopes); ok {
+		fields = append(fields, zap.Strings(instanceSADefaultScopes, strings.Fields(v)))
+	}
+
+	if v, ok := get(instanceSADefaultToken); ok {
+		token, err := parseServiceAccountToken(v)
+		if err != nil {
+			logger.Warn("could not parse service account token", zap.Error(err))
+		} else {
+			fields = append(fields, zap.Object(instanceSADefaultToken, token))
+		}
+	}
+
+	fields = append(fields,
+		zap.String("K_SERVICE", info.Service),
+		zap.String("K_REVISION", info.Revision),
+		zap.String("K_CONFIGURATION", info.Configuration),
+	)
+	logger.Info("metadata", fields...)
+
+	return info
+}
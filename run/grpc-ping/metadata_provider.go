@@ -0,0 +1,249 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+// metadataProvider looks up metadata of the instance the server runs on.
+//
+// Keys are paths relative to /computeMetadata/v1/, e.g. "project/project-id".
+// A key which is not defined results in a metadata.NotDefinedError.
+type metadataProvider interface {
+	Get(key string) (string, error)
+}
+
+// The GRPC_PING_METADATA environment variable selects the metadataProvider.
+const (
+	// metadataGCE queries the metadata server of Google Cloud, or the one GCE_METADATA_HOST points to.
+	metadataGCE = "gce"
+
+	// metadataStatic serves the values of newStaticMetadataProvider without any metadata server.
+	metadataStatic = "static"
+
+	// metadataFake starts a fakeMetadataServer serving the values of newStaticMetadataProvider,
+	// and points GCE_METADATA_HOST to it so client libraries use it too.
+	metadataFake = "fake"
+)
+
+// fakeMetadata is the fake metadata server started by newMetadataProvider, if any.
+var fakeMetadata *fakeMetadataServer
+
+// newMetadataProvider returns the metadataProvider selected by mode.
+//
+// An empty mode selects metadataGCE when a metadata server is reachable, on any Google Cloud host or when
+// GCE_METADATA_HOST is set, and metadataStatic otherwise. metadataFake redirects every metadata client of the process,
+// so it is only used when selected explicitly.
+// It runs before the logger is created since the logger itself detects its environment from the metadata server.
+func newMetadataProvider(mode string) (metadataProvider, error) {
+	if mode == "" {
+		mode = metadataStatic
+		if metadata.OnGCE() {
+			mode = metadataGCE
+		}
+	}
+
+	switch mode {
+	case metadataGCE:
+		return metadata.NewClient(http.DefaultClient), nil
+
+	case metadataStatic:
+		return newStaticMetadataProvider(), nil
+
+	case metadataFake:
+		srv, err := newFakeMetadataServer(newStaticMetadataProvider())
+		if err != nil {
+			return nil, err
+		}
+		fakeMetadata = srv
+
+		// Make the metadata package, and the libraries built on top of it, use the fake server.
+		if err := os.Setenv("GCE_METADATA_HOST", srv.Host()); err != nil {
+			return nil, err
+		}
+		// Complete the Cloud Run container contract for the parts of the server that read it.
+		for env, value := range map[string]string{
+			"K_SERVICE":       "grpc-ping",
+			"K_REVISION":      "grpc-ping-local",
+			"K_CONFIGURATION": "grpc-ping",
+		} {
+			if os.Getenv(env) == "" {
+				if err := os.Setenv(env, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return metadata.NewClient(http.DefaultClient), nil
+
+	default:
+		return nil, fmt.Errorf("unknown metadata provider %q: must be one of %q, %q or %q", mode, metadataGCE, metadataStatic, metadataFake)
+	}
+}
+
+// staticMetadataProvider serves metadata from a fixed set of values.
+type staticMetadataProvider map[string]string
+
+// staticMetadata lists the values of newStaticMetadataProvider and the environment variables overriding them.
+var staticMetadata = []struct {
+	key   string
+	env   string
+	value string
+}{
+	{projectProjectID, "GOOGLE_CLOUD_PROJECT", "local-project"},
+	{projectNumericProjectID, "GRPC_PING_METADATA_NUMERIC_PROJECT_ID", "0"},
+	{instanceRegion, "GRPC_PING_METADATA_REGION", "projects/0/regions/local"},
+	{instanceID, "GRPC_PING_METADATA_INSTANCE_ID", "local"},
+	{instanceSADefaultEmail, "GRPC_PING_METADATA_SERVICE_ACCOUNT", "grpc-ping@local-project.iam.gserviceaccount.com"},
+	{instanceSADefaultScopes, "", "https://www.googleapis.com/auth/cloud-platform\n"},
+	{instanceSADefaultToken, "", `{"access_token":"local-access-token","expires_in":3599,"token_type":"Bearer"}`},
+}
+
+// newStaticMetadataProvider returns a staticMetadataProvider with values describing a local instance,
+// overridden by the environment variables listed in staticMetadata.
+func newStaticMetadataProvider() staticMetadataProvider {
+	p := make(staticMetadataProvider, len(staticMetadata))
+	for _, md := range staticMetadata {
+		p[md.key] = md.value
+		if v := os.Getenv(md.env); md.env != "" && v != "" {
+			p[md.key] = v
+		}
+	}
+	return p
+}
+
+// Get implements metadataProvider.
+func (p staticMetadataProvider) Get(key string) (string, error) {
+	v, ok := p[key]
+	if !ok {
+		return "", metadata.NotDefinedError(key)
+	}
+	return v, nil
+}
+
+// fakeMetadataServer is an in-process HTTP server mimicking the metadata server of Cloud Run.
+//
+// It serves the project/* and instance/* keys of a metadataProvider, plus unsigned ID tokens on
+// instance/service-accounts/default/identity so authenticated upstream requests can be made locally.
+type fakeMetadataServer struct {
+	values   metadataProvider
+	listener net.Listener
+	srv      *http.Server
+}
+
+// newFakeMetadataServer starts a fakeMetadataServer on a random loopback port.
+func newFakeMetadataServer(values metadataProvider) (*fakeMetadataServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fakeMetadataServer{
+		values:   values,
+		listener: listener,
+	}
+	s.srv = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go s.srv.Serve(listener)
+
+	return s, nil
+}
+
+// Host returns the host:port the server listens on, suitable for GCE_METADATA_HOST.
+func (s *fakeMetadataServer) Host() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server.
+func (s *fakeMetadataServer) Close() error {
+	return s.srv.Close()
+}
+
+const metadataPathPrefix = "/computeMetadata/v1/"
+
+// ServeHTTP implements http.Handler.
+func (s *fakeMetadataServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Metadata-Flavor") != "Google" {
+		http.Error(w, "Missing Metadata-Flavor:Google header.", http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, metadataPathPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Metadata-Flavor", "Google")
+	w.Header().Set("Content-Type", "application/text")
+
+	key := strings.TrimPrefix(r.URL.Path, metadataPathPrefix)
+	switch {
+	case key == "":
+		// Some clients probe the root to check that a metadata server is active.
+		fmt.Fprint(w, "instance/\nproject/\n")
+
+	case key == instanceSADefaultIdentity:
+		email, _ := s.values.Get(instanceSADefaultEmail)
+		fmt.Fprint(w, fakeIDToken(r.URL.Query().Get("audience"), email))
+
+	case strings.HasPrefix(key, "project/"), strings.HasPrefix(key, "instance/"):
+		v, err := s.values.Get(key)
+		var notDefined metadata.NotDefinedError
+		if errors.As(err, &notDefined) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, v)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fakeIDToken returns an unsigned ID token for audience, valid for one hour.
+//
+// It has the shape of the tokens of the real metadata server but no signature, so idTokenVerifier rejects it.
+func fakeIDToken(audience, email string) string {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{
+		"alg": "none",
+		"typ": "JWT",
+	})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"aud":            audience,
+		"email":          email,
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+
+	return enc.EncodeToString(header) + "." + enc.EncodeToString(payload) + "."
+}
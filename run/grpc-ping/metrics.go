@@ -0,0 +1,354 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const metricsNamespace = "grpc_ping"
+
+// Protocols of the requests served, the protocol label of serverMetrics.
+const (
+	protocolGRPC    = "grpc"
+	protocolConnect = "connect"
+)
+
+// latencyBuckets are the buckets of the latency histograms, in seconds, from 1ms to ~16s.
+var latencyBuckets = prometheus.ExponentialBuckets(0.001, 2, 15)
+
+var (
+	// metrics records the RPCs served.
+	metrics = newServerMetrics()
+
+	// upstreamMetrics records the RPCs made to the upstream ping service.
+	upstreamMetrics = newClientMetrics()
+
+	// idTokenMintDuration records how long minting the ID tokens of upstream requests takes.
+	idTokenMintDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "id_token_mint_duration_seconds",
+		Help:      "Latency of minting an ID token for upstream requests.",
+		Buckets:   latencyBuckets,
+	}, []string{"result"})
+)
+
+// newMetricsHandler returns the http.Handler serving the metrics, in the Prometheus or OpenMetrics text format.
+func newMetricsHandler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics,
+		upstreamMetrics,
+		upstreamHedge,
+		idTokenMintDuration,
+		idTokenCacheCollector{cache: idTokens},
+	)
+
+	for _, u := range upstreams {
+		reg.MustRegister(u.breaker)
+	}
+
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	})
+}
+
+// serverMetrics records the count, latency and number in flight of the RPCs served, by protocol, method and status code.
+// Streaming RPCs are recorded once they end.
+type serverMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+	panics   *prometheus.CounterVec
+}
+
+var _ prometheus.Collector = (*serverMetrics)(nil)
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "server",
+			Name:      "requests_total",
+			Help:      "RPCs served, by protocol, method and status code.",
+		}, []string{"protocol", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "server",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the RPCs served, by protocol, method and status code.",
+			Buckets:   latencyBuckets,
+		}, []string{"protocol", "method", "code"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "server",
+			Name:      "requests_in_flight",
+			Help:      "RPCs being served, by protocol and method.",
+		}, []string{"protocol", "method"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "server",
+			Name:      "panics_total",
+			Help:      "Panics recovered while serving RPCs, by protocol and method.",
+		}, []string{"protocol", "method"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *serverMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.duration.Describe(ch)
+	m.inFlight.Describe(ch)
+	m.panics.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *serverMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.duration.Collect(ch)
+	m.inFlight.Collect(ch)
+	m.panics.Collect(ch)
+}
+
+// panicked records a panic recovered while serving an RPC.
+func (m *serverMetrics) panicked(protocol, method string) {
+	m.panics.WithLabelValues(protocol, method).Inc()
+}
+
+// start records the start of an RPC, the returned function records its end.
+func (m *serverMetrics) start(protocol, method string) func(code codes.Code) {
+	start := time.Now()
+	inFlight := m.inFlight.WithLabelValues(protocol, method)
+	inFlight.Inc()
+
+	return func(code codes.Code) {
+		inFlight.Dec()
+		m.requests.WithLabelValues(protocol, method, code.String()).Inc()
+		m.duration.WithLabelValues(protocol, method, code.String()).Observe(time.Since(start).Seconds())
+	}
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor that records Unary RPCs, except those of the health and
+// reflection services.
+func (m *serverMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isInfrastructureMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		done := m.start(protocolGRPC, info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(status.Code(err))
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is a gRPC server-side interceptor that records Streaming RPCs, except those of the health
+// and reflection services.
+func (m *serverMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isInfrastructureMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		done := m.start(protocolGRPC, info.FullMethod)
+		err := handler(srv, ss)
+		done(status.Code(err))
+
+		return err
+	}
+}
+
+// ConnectInterceptor is a Connect handler interceptor that records RPCs.
+func (m *serverMetrics) ConnectInterceptor() connect.Interceptor {
+	return connectInterceptorFunc(func(ctx context.Context, spec connect.Spec, header http.Header, call func(ctx context.Context) error) error {
+		done := m.start(protocolConnect, spec.Procedure)
+		err := call(ctx)
+		done(connectCode(err))
+
+		return err
+	})
+}
+
+// connectCode returns the gRPC status code of the Connect error err. Both protocols share the same codes.
+func connectCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	return codes.Code(connect.CodeOf(err))
+}
+
+// clientMetrics records the count, latency and number in flight of the RPCs made, by method and status code.
+// Streaming RPCs are recorded once they end.
+type clientMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+var _ prometheus.Collector = (*clientMetrics)(nil)
+
+func newClientMetrics() *clientMetrics {
+	return &clientMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "upstream",
+			Name:      "requests_total",
+			Help:      "RPCs made to the upstream ping service, by method and status code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "upstream",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the RPCs made to the upstream ping service, by method and status code.",
+			Buckets:   latencyBuckets,
+		}, []string{"method", "code"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "upstream",
+			Name:      "requests_in_flight",
+			Help:      "RPCs in flight to the upstream ping service, by method.",
+		}, []string{"method"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *clientMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.duration.Describe(ch)
+	m.inFlight.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *clientMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.duration.Collect(ch)
+	m.inFlight.Collect(ch)
+}
+
+// start records the start of an RPC, the returned function records its end.
+func (m *clientMetrics) start(method string) func(code codes.Code) {
+	start := time.Now()
+	inFlight := m.inFlight.WithLabelValues(method)
+	inFlight.Inc()
+
+	return func(code codes.Code) {
+		inFlight.Dec()
+		m.requests.WithLabelValues(method, code.String()).Inc()
+		m.duration.WithLabelValues(method, code.String()).Observe(time.Since(start).Seconds())
+	}
+}
+
+// UnaryClientInterceptor is a gRPC client-side interceptor that records Unary RPCs.
+func (m *clientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done := m.start(method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		done(status.Code(err))
+
+		return err
+	}
+}
+
+// StreamClientInterceptor is a gRPC client-side interceptor that records Streaming RPCs.
+func (m *clientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done := m.start(method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			done(status.Code(err))
+			return nil, err
+		}
+
+		s := &clientStream{ClientStream: cs, desc: desc, done: done}
+		// A stream also ends when the caller cancels it without receiving its last message.
+		go func() {
+			<-ctx.Done()
+			s.finish(status.FromContextError(ctx.Err()).Code())
+		}()
+		return s, nil
+	}
+}
+
+// clientStream wraps grpc.ClientStream to record the end of the stream.
+type clientStream struct {
+	grpc.ClientStream
+	desc *grpc.StreamDesc
+	once sync.Once
+	done func(code codes.Code)
+}
+
+// RecvMsg implements grpc.ClientStream.
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF:
+		s.finish(codes.OK)
+	case err != nil:
+		s.finish(status.Code(err))
+	case !s.desc.ServerStreams:
+		// Client-streaming RPCs end with their single response, CloseAndRecv does not read io.EOF.
+		s.finish(codes.OK)
+	}
+	return err
+}
+
+func (s *clientStream) finish(code codes.Code) {
+	s.once.Do(func() {
+		s.done(code)
+	})
+}
+
+// idTokenCacheCollector exports the counters of an idTokenCache.
+type idTokenCacheCollector struct {
+	cache *idTokenCache
+}
+
+var (
+	idTokenCacheHitsDesc            = prometheus.NewDesc(metricsNamespace+"_id_token_cache_hits_total", "ID tokens served from the cache.", nil, nil)
+	idTokenCacheMissesDesc          = prometheus.NewDesc(metricsNamespace+"_id_token_cache_misses_total", "ID tokens minted while the caller waited.", nil, nil)
+	idTokenCacheRefreshesDesc       = prometheus.NewDesc(metricsNamespace+"_id_token_cache_refreshes_total", "ID tokens minted in the background.", nil, nil)
+	idTokenCacheRefreshFailuresDesc = prometheus.NewDesc(metricsNamespace+"_id_token_cache_refresh_failures_total", "Failed background ID token refreshes.", nil, nil)
+)
+
+// Describe implements prometheus.Collector.
+func (c idTokenCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- idTokenCacheHitsDesc
+	ch <- idTokenCacheMissesDesc
+	ch <- idTokenCacheRefreshesDesc
+	ch <- idTokenCacheRefreshFailuresDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c idTokenCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(idTokenCacheHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(idTokenCacheMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(idTokenCacheRefreshesDesc, prometheus.CounterValue, float64(stats.Refreshes))
+	ch <- prometheus.MustNewConstMetric(idTokenCacheRefreshFailuresDesc, prometheus.CounterValue, float64(stats.RefreshFailures))
+}
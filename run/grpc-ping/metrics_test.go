@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClientStream is a grpc.ClientStream whose RecvMsg returns the errors of recv in turn.
+type fakeClientStream struct {
+	grpc.ClientStream
+	recv []error
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	err := s.recv[0]
+	s.recv = s.recv[1:]
+	return err
+}
+
+func TestClientMetricsStreamClientInterceptor(t *testing.T) {
+	const method = "/ping.PingService/Test"
+
+	tests := []struct {
+		name string
+		desc *grpc.StreamDesc
+		recv []error
+		want codes.Code
+	}{
+		{
+			name: "client streaming",
+			desc: &grpc.StreamDesc{ClientStreams: true},
+			recv: []error{nil},
+			want: codes.OK,
+		},
+		{
+			name: "client streaming error",
+			desc: &grpc.StreamDesc{ClientStreams: true},
+			recv: []error{status.Error(codes.Unavailable, "unavailable")},
+			want: codes.Unavailable,
+		},
+		{
+			name: "server streaming",
+			desc: &grpc.StreamDesc{ServerStreams: true},
+			recv: []error{nil, nil, io.EOF},
+			want: codes.OK,
+		},
+		{
+			name: "bidi streaming",
+			desc: &grpc.StreamDesc{ClientStreams: true, ServerStreams: true},
+			recv: []error{nil, io.EOF},
+			want: codes.OK,
+		},
+		{
+			name: "server streaming canceled",
+			desc: &grpc.StreamDesc{ServerStreams: true},
+			recv: []error{nil},
+			want: codes.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := newClientMetrics()
+			streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return &fakeClientStream{recv: tt.recv}, nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cs, err := m.StreamClientInterceptor()(ctx, tt.desc, nil, method, streamer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range tt.recv {
+				cs.RecvMsg(nil)
+			}
+			// The caller cancels the context once done with the stream, e.g. when the handler returns.
+			cancel()
+
+			requests := m.requests.WithLabelValues(method, tt.want.String())
+			deadline := time.Now().Add(5 * time.Second)
+			for testutil.ToFloat64(requests) == 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if got := testutil.CollectAndCount(m.requests); got != 1 {
+				t.Errorf("recorded %d series, want 1", got)
+			}
+			if got := testutil.ToFloat64(requests); got != 1 {
+				t.Errorf("requests{code=%q} = %v, want 1", tt.want, got)
+			}
+			if got := testutil.ToFloat64(m.inFlight.WithLabelValues(method)); got != 0 {
+				t.Errorf("in flight = %v, want 0", got)
+			}
+		})
+	}
+}
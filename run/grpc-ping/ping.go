@@ -17,12 +17,16 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
+	"io"
+	"strconv"
 	"strings"
+	"time"
 
 	zapcloudlogging "github.com/zchee/zap-cloudlogging"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
@@ -31,6 +35,26 @@ import (
 
 type pingService struct {
 	pb.UnimplementedPingServiceServer
+
+	// info identifies this server in the pongs and responses it produces or relays.
+	info *pb.ServerInfo
+}
+
+// pong returns a Pong produced by this server.
+func (s *pingService) pong(index int32, message string) *pb.Pong {
+	return &pb.Pong{
+		Index:      index,
+		Message:    message,
+		ReceivedOn: timestamppb.Now(),
+		ServedBy:   s.info,
+	}
+}
+
+// ServerInfo returns the identity of this server.
+func (s *pingService) ServerInfo(ctx context.Context, req *pb.ServerInfoRequest) (*pb.ServerInfoResponse, error) {
+	return &pb.ServerInfoResponse{
+		ServerInfo: s.info,
+	}, nil
 }
 
 func (s *pingService) Send(ctx context.Context, req *pb.Request) (*pb.Response, error) {
@@ -39,47 +63,189 @@ func (s *pingService) Send(ctx context.Context, req *pb.Request) (*pb.Response,
 	logger.Info("sending ping response")
 
 	return &pb.Response{
-		Pong: &pb.Pong{
-			Index:      1,
-			Message:    req.GetMessage(),
-			ReceivedOn: timestamppb.Now(),
-		},
+		Pong: s.pong(1, req.GetMessage()),
+		Hops: []*pb.ServerInfo{s.info},
 	}, nil
 }
 
 func (s *pingService) SendUpstream(ctx context.Context, req *pb.Request) (*pb.Response, error) {
 	logger := zapcloudlogging.FromContext(ctx)
 
-	if conn == nil {
-		return nil, fmt.Errorf("no upstream connection configured")
+	u := primaryUpstream()
+	if u == nil {
+		return nil, errNoUpstream
 	}
 
 	p := &pb.Request{
-		Message: req.GetMessage() + " (relayed)",
+		Message: relayedMessage(req.GetMessage()),
 	}
 
-	hostWithoutPort := strings.Split(os.Getenv("GRPC_PING_HOST"), ":")[0]
-	tokenAudience := "https://" + hostWithoutPort
-	resp, err := PingRequest(conn, p, tokenAudience, os.Getenv("GRPC_PING_UNAUTHENTICATED") == "")
+	ctx, attempts := withAttemptCounter(ctx)
+	ctx, hedges := withHedgeStats(ctx)
+	resp, err := PingRequest(ctx, u.conn, p, u.audience, u.authenticated)
+	// Let the caller know how hard it was to reach the upstream service, whether it succeeded or not.
+	n := attempts.Load()
+	md := metadata.Pairs(attemptsHeader, strconv.Itoa(int(n)))
+	fields := []zap.Field{zap.Int32("attempts", n)}
+	if upstreamHedge.Enabled() {
+		md.Set(hedgesHeader, strconv.Itoa(hedges.Hedges()))
+		fields = append(fields, zap.Object("hedging", hedges))
+	}
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		logger.Warn("could not set response header", zap.String("header", attemptsHeader), zap.Error(err))
+	}
 	if err != nil {
-		logger.Error("PingRequest", zap.Error(err))
-		c := status.Code(err)
-		return nil, status.Errorf(c, "Could not reach ping service: %s", status.Convert(err).Message())
+		logger.Error("PingRequest", append(fields, zap.Error(err))...)
+		return nil, upstreamError(err)
 	}
 
-	logger.Info("received upstream pong")
+	logger.Info("received upstream pong", fields...)
 	return &pb.Response{
 		Pong: resp.Pong,
+		Hops: append(resp.Hops, s.info),
 	}, nil
 }
 
-// UnaryServerInterceptor is a gRPC server-side interceptor that provides reporting for Unary RPCs.
-func UnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
-	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		logger.Info("gRPC info", zap.Any("req", req), zap.Any("info", info))
+// errNoUpstream is returned by the relay methods when neither GRPC_PING_HOST nor GRPC_PING_UPSTREAMS is configured.
+var errNoUpstream = fmt.Errorf("no upstream connection configured")
 
-		ctx = zapcloudlogging.NewContext(ctx, logger)
+// relayedMessage marks message as relayed to the upstream service.
+func relayedMessage(message string) string {
+	return message + " (relayed)"
+}
+
+// upstreamError converts err returned by the upstream service into the error returned to the caller, keeping its status code.
+func upstreamError(err error) error {
+	// Keep the details, e.g. the retry hint of an open circuit.
+	st := status.Convert(err).Proto()
+	st.Message = "Could not reach ping service: " + st.GetMessage()
+	return status.ErrorProto(st)
+}
+
+// defaultSubscribeInterval is the delay between two pongs when the SubscribeRequest does not set one.
+const defaultSubscribeInterval = time.Second
 
-		return handler(ctx, req)
+// Subscribe streams req.Count pongs to the client, one per req.Interval, with an incrementing index.
+func (s *pingService) Subscribe(req *pb.SubscribeRequest, stream pb.PingService_SubscribeServer) error {
+	ctx := stream.Context()
+	logger := zapcloudlogging.FromContext(ctx)
+
+	count := req.GetCount()
+	if count <= 0 {
+		return status.Errorf(codes.InvalidArgument, "count must be positive: %d", count)
 	}
+	interval := defaultSubscribeInterval
+	if req.GetInterval() != nil {
+		interval = req.GetInterval().AsDuration()
+		if interval <= 0 {
+			return status.Errorf(codes.InvalidArgument, "interval must be positive: %s", interval)
+		}
+	}
+
+	logger.Info("starting pong subscription", zap.Int32("count", count), zap.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for index := int32(1); ; index++ {
+		err := stream.Send(&pb.Response{
+			Pong: s.pong(index, req.GetMessage()),
+			Hops: []*pb.ServerInfo{s.info},
+		})
+		if err != nil {
+			logger.Error("could not send pong", zap.Int32("index", index), zap.Error(err))
+			return err
+		}
+		if index == count {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("pong subscription canceled", zap.Int32("sent", index), zap.Error(ctx.Err()))
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+
+	logger.Info("finished pong subscription", zap.Int32("sent", count))
+	return nil
+}
+
+// PingPong answers each Request received on the stream right away with a Pong on the same stream.
+func (s *pingService) PingPong(stream pb.PingService_PingPongServer) error {
+	logger := zapcloudlogging.FromContext(stream.Context())
+
+	var index int32
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			logger.Info("finished ping pong", zap.Int32("count", index))
+			return nil
+		}
+		if err != nil {
+			logger.Error("could not receive ping", zap.Int32("count", index), zap.Error(err))
+			return err
+		}
+
+		index++
+		err = stream.Send(&pb.Response{
+			Pong: s.pong(index, req.GetMessage()),
+			Hops: []*pb.ServerInfo{s.info},
+		})
+		if err != nil {
+			logger.Error("could not send pong", zap.Int32("index", index), zap.Error(err))
+			return err
+		}
+	}
+}
+
+// SendBatch aggregates all Requests received on the stream into a single BatchResponse.
+func (s *pingService) SendBatch(stream pb.PingService_SendBatchServer) error {
+	ctx := stream.Context()
+	logger := zapcloudlogging.FromContext(ctx)
+
+	resp := &pb.BatchResponse{
+		Hops: []*pb.ServerInfo{s.info},
+	}
+	var messages []string
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The client canceled the stream or its deadline expired before it was closed.
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				logger.Info("batch aborted", zap.Int32("count", resp.Count), zap.Error(ctxErr))
+				return status.FromContextError(ctxErr).Err()
+			}
+			logger.Error("could not receive ping", zap.Int32("count", resp.Count), zap.Error(err))
+			return err
+		}
+
+		now := timestamppb.Now()
+		if resp.FirstReceivedOn == nil {
+			resp.FirstReceivedOn = now
+		}
+		resp.LastReceivedOn = now
+		resp.Count++
+		resp.TotalBytes += int64(len(req.GetMessage()))
+		messages = append(messages, req.GetMessage())
+	}
+	resp.Message = strings.Join(messages, " ")
+
+	logger.Info("received batch", zap.Int32("count", resp.Count), zap.Int64("total_bytes", resp.TotalBytes))
+	return stream.SendAndClose(resp)
+}
+
+// serverStream wraps grpc.ServerStream to override its context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
 }
@@ -24,6 +24,15 @@ const _ = grpc.SupportPackageIsVersion7
 type PingServiceClient interface {
 	Send(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
 	SendUpstream(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (PingService_SubscribeClient, error)
+	PingPong(ctx context.Context, opts ...grpc.CallOption) (PingService_PingPongClient, error)
+	SendBatch(ctx context.Context, opts ...grpc.CallOption) (PingService_SendBatchClient, error)
+	SubscribeUpstream(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (PingService_SubscribeUpstreamClient, error)
+	PingPongUpstream(ctx context.Context, opts ...grpc.CallOption) (PingService_PingPongUpstreamClient, error)
+	SendBatchUpstream(ctx context.Context, opts ...grpc.CallOption) (PingService_SendBatchUpstreamClient, error)
+	ServerInfo(ctx context.Context, in *ServerInfoRequest, opts ...grpc.CallOption) (*ServerInfoResponse, error)
+	// Broadcast relays the request to every upstream service and reports the result of each.
+	Broadcast(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*BroadcastResponse, error)
 }
 
 type pingServiceClient struct {
@@ -52,12 +61,233 @@ func (c *pingServiceClient) SendUpstream(ctx context.Context, in *Request, opts
 	return out, nil
 }
 
+func (c *pingServiceClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (PingService_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PingService_ServiceDesc.Streams[0], "/ping.PingService/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServiceSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PingService_SubscribeClient interface {
+	Recv() (*Response, error)
+	grpc.ClientStream
+}
+
+type pingServiceSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServiceSubscribeClient) Recv() (*Response, error) {
+	m := new(Response)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pingServiceClient) PingPong(ctx context.Context, opts ...grpc.CallOption) (PingService_PingPongClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PingService_ServiceDesc.Streams[1], "/ping.PingService/PingPong", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServicePingPongClient{stream}
+	return x, nil
+}
+
+type PingService_PingPongClient interface {
+	Send(*Request) error
+	Recv() (*Response, error)
+	grpc.ClientStream
+}
+
+type pingServicePingPongClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServicePingPongClient) Send(m *Request) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pingServicePingPongClient) Recv() (*Response, error) {
+	m := new(Response)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pingServiceClient) SendBatch(ctx context.Context, opts ...grpc.CallOption) (PingService_SendBatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PingService_ServiceDesc.Streams[2], "/ping.PingService/SendBatch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServiceSendBatchClient{stream}
+	return x, nil
+}
+
+type PingService_SendBatchClient interface {
+	Send(*Request) error
+	CloseAndRecv() (*BatchResponse, error)
+	grpc.ClientStream
+}
+
+type pingServiceSendBatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServiceSendBatchClient) Send(m *Request) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pingServiceSendBatchClient) CloseAndRecv() (*BatchResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(BatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pingServiceClient) SubscribeUpstream(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (PingService_SubscribeUpstreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PingService_ServiceDesc.Streams[3], "/ping.PingService/SubscribeUpstream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServiceSubscribeUpstreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PingService_SubscribeUpstreamClient interface {
+	Recv() (*Response, error)
+	grpc.ClientStream
+}
+
+type pingServiceSubscribeUpstreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServiceSubscribeUpstreamClient) Recv() (*Response, error) {
+	m := new(Response)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pingServiceClient) PingPongUpstream(ctx context.Context, opts ...grpc.CallOption) (PingService_PingPongUpstreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PingService_ServiceDesc.Streams[4], "/ping.PingService/PingPongUpstream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServicePingPongUpstreamClient{stream}
+	return x, nil
+}
+
+type PingService_PingPongUpstreamClient interface {
+	Send(*Request) error
+	Recv() (*Response, error)
+	grpc.ClientStream
+}
+
+type pingServicePingPongUpstreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServicePingPongUpstreamClient) Send(m *Request) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pingServicePingPongUpstreamClient) Recv() (*Response, error) {
+	m := new(Response)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pingServiceClient) SendBatchUpstream(ctx context.Context, opts ...grpc.CallOption) (PingService_SendBatchUpstreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PingService_ServiceDesc.Streams[5], "/ping.PingService/SendBatchUpstream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingServiceSendBatchUpstreamClient{stream}
+	return x, nil
+}
+
+type PingService_SendBatchUpstreamClient interface {
+	Send(*Request) error
+	CloseAndRecv() (*BatchResponse, error)
+	grpc.ClientStream
+}
+
+type pingServiceSendBatchUpstreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingServiceSendBatchUpstreamClient) Send(m *Request) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pingServiceSendBatchUpstreamClient) CloseAndRecv() (*BatchResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(BatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pingServiceClient) ServerInfo(ctx context.Context, in *ServerInfoRequest, opts ...grpc.CallOption) (*ServerInfoResponse, error) {
+	out := new(ServerInfoResponse)
+	err := c.cc.Invoke(ctx, "/ping.PingService/ServerInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pingServiceClient) Broadcast(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*BroadcastResponse, error) {
+	out := new(BroadcastResponse)
+	err := c.cc.Invoke(ctx, "/ping.PingService/Broadcast", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PingServiceServer is the server API for PingService service.
 // All implementations must embed UnimplementedPingServiceServer
 // for forward compatibility
 type PingServiceServer interface {
 	Send(context.Context, *Request) (*Response, error)
 	SendUpstream(context.Context, *Request) (*Response, error)
+	Subscribe(*SubscribeRequest, PingService_SubscribeServer) error
+	PingPong(PingService_PingPongServer) error
+	SendBatch(PingService_SendBatchServer) error
+	SubscribeUpstream(*SubscribeRequest, PingService_SubscribeUpstreamServer) error
+	PingPongUpstream(PingService_PingPongUpstreamServer) error
+	SendBatchUpstream(PingService_SendBatchUpstreamServer) error
+	ServerInfo(context.Context, *ServerInfoRequest) (*ServerInfoResponse, error)
+	// Broadcast relays the request to every upstream service and reports the result of each.
+	Broadcast(context.Context, *BroadcastRequest) (*BroadcastResponse, error)
 	mustEmbedUnimplementedPingServiceServer()
 }
 
@@ -71,6 +301,30 @@ func (UnimplementedPingServiceServer) Send(context.Context, *Request) (*Response
 func (UnimplementedPingServiceServer) SendUpstream(context.Context, *Request) (*Response, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendUpstream not implemented")
 }
+func (UnimplementedPingServiceServer) Subscribe(*SubscribeRequest, PingService_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedPingServiceServer) PingPong(PingService_PingPongServer) error {
+	return status.Errorf(codes.Unimplemented, "method PingPong not implemented")
+}
+func (UnimplementedPingServiceServer) SendBatch(PingService_SendBatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method SendBatch not implemented")
+}
+func (UnimplementedPingServiceServer) SubscribeUpstream(*SubscribeRequest, PingService_SubscribeUpstreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeUpstream not implemented")
+}
+func (UnimplementedPingServiceServer) PingPongUpstream(PingService_PingPongUpstreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method PingPongUpstream not implemented")
+}
+func (UnimplementedPingServiceServer) SendBatchUpstream(PingService_SendBatchUpstreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SendBatchUpstream not implemented")
+}
+func (UnimplementedPingServiceServer) ServerInfo(context.Context, *ServerInfoRequest) (*ServerInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ServerInfo not implemented")
+}
+func (UnimplementedPingServiceServer) Broadcast(context.Context, *BroadcastRequest) (*BroadcastResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Broadcast not implemented")
+}
 func (UnimplementedPingServiceServer) mustEmbedUnimplementedPingServiceServer() {}
 
 // UnsafePingServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -120,6 +374,188 @@ func _PingService_SendUpstream_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PingService_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PingServiceServer).Subscribe(m, &pingServiceSubscribeServer{stream})
+}
+
+type PingService_SubscribeServer interface {
+	Send(*Response) error
+	grpc.ServerStream
+}
+
+type pingServiceSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServiceSubscribeServer) Send(m *Response) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PingService_PingPong_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PingServiceServer).PingPong(&pingServicePingPongServer{stream})
+}
+
+type PingService_PingPongServer interface {
+	Send(*Response) error
+	Recv() (*Request, error)
+	grpc.ServerStream
+}
+
+type pingServicePingPongServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServicePingPongServer) Send(m *Response) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pingServicePingPongServer) Recv() (*Request, error) {
+	m := new(Request)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PingService_SendBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PingServiceServer).SendBatch(&pingServiceSendBatchServer{stream})
+}
+
+type PingService_SendBatchServer interface {
+	SendAndClose(*BatchResponse) error
+	Recv() (*Request, error)
+	grpc.ServerStream
+}
+
+type pingServiceSendBatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServiceSendBatchServer) SendAndClose(m *BatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pingServiceSendBatchServer) Recv() (*Request, error) {
+	m := new(Request)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PingService_SubscribeUpstream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PingServiceServer).SubscribeUpstream(m, &pingServiceSubscribeUpstreamServer{stream})
+}
+
+type PingService_SubscribeUpstreamServer interface {
+	Send(*Response) error
+	grpc.ServerStream
+}
+
+type pingServiceSubscribeUpstreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServiceSubscribeUpstreamServer) Send(m *Response) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PingService_PingPongUpstream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PingServiceServer).PingPongUpstream(&pingServicePingPongUpstreamServer{stream})
+}
+
+type PingService_PingPongUpstreamServer interface {
+	Send(*Response) error
+	Recv() (*Request, error)
+	grpc.ServerStream
+}
+
+type pingServicePingPongUpstreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServicePingPongUpstreamServer) Send(m *Response) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pingServicePingPongUpstreamServer) Recv() (*Request, error) {
+	m := new(Request)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PingService_SendBatchUpstream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PingServiceServer).SendBatchUpstream(&pingServiceSendBatchUpstreamServer{stream})
+}
+
+type PingService_SendBatchUpstreamServer interface {
+	SendAndClose(*BatchResponse) error
+	Recv() (*Request, error)
+	grpc.ServerStream
+}
+
+type pingServiceSendBatchUpstreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingServiceSendBatchUpstreamServer) SendAndClose(m *BatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pingServiceSendBatchUpstreamServer) Recv() (*Request, error) {
+	m := new(Request)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PingService_ServerInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PingServiceServer).ServerInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ping.PingService/ServerInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PingServiceServer).ServerInfo(ctx, req.(*ServerInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PingService_Broadcast_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BroadcastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PingServiceServer).Broadcast(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ping.PingService/Broadcast",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PingServiceServer).Broadcast(ctx, req.(*BroadcastRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // PingService_ServiceDesc is the grpc.ServiceDesc for PingService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -135,7 +571,48 @@ var PingService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendUpstream",
 			Handler:    _PingService_SendUpstream_Handler,
 		},
+		{
+			MethodName: "ServerInfo",
+			Handler:    _PingService_ServerInfo_Handler,
+		},
+		{
+			MethodName: "Broadcast",
+			Handler:    _PingService_Broadcast_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _PingService_Subscribe_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PingPong",
+			Handler:       _PingService_PingPong_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SendBatch",
+			Handler:       _PingService_SendBatch_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SubscribeUpstream",
+			Handler:       _PingService_SubscribeUpstream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PingPongUpstream",
+			Handler:       _PingService_PingPongUpstream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SendBatchUpstream",
+			Handler:       _PingService_SendBatchUpstream_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "api/v1/message.proto",
 }
@@ -0,0 +1,361 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// [START cloudrun_grpc_protodef]
+// [START run_grpc_protodef]
+
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: api/v1/message.proto
+
+package v1connect
+
+import (
+	context "context"
+	errors "errors"
+	connect_go "github.com/bufbuild/connect-go"
+	v1 "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect_go.IsAtLeastVersion0_1_0
+
+const (
+	// PingServiceName is the fully-qualified name of the PingService service.
+	PingServiceName = "ping.PingService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// PingServiceSendProcedure is the fully-qualified name of the PingService's Send RPC.
+	PingServiceSendProcedure = "/ping.PingService/Send"
+	// PingServiceSendUpstreamProcedure is the fully-qualified name of the PingService's SendUpstream
+	// RPC.
+	PingServiceSendUpstreamProcedure = "/ping.PingService/SendUpstream"
+	// PingServiceSubscribeProcedure is the fully-qualified name of the PingService's Subscribe RPC.
+	PingServiceSubscribeProcedure = "/ping.PingService/Subscribe"
+	// PingServicePingPongProcedure is the fully-qualified name of the PingService's PingPong RPC.
+	PingServicePingPongProcedure = "/ping.PingService/PingPong"
+	// PingServiceSendBatchProcedure is the fully-qualified name of the PingService's SendBatch RPC.
+	PingServiceSendBatchProcedure = "/ping.PingService/SendBatch"
+	// PingServiceSubscribeUpstreamProcedure is the fully-qualified name of the PingService's
+	// SubscribeUpstream RPC.
+	PingServiceSubscribeUpstreamProcedure = "/ping.PingService/SubscribeUpstream"
+	// PingServicePingPongUpstreamProcedure is the fully-qualified name of the PingService's
+	// PingPongUpstream RPC.
+	PingServicePingPongUpstreamProcedure = "/ping.PingService/PingPongUpstream"
+	// PingServiceSendBatchUpstreamProcedure is the fully-qualified name of the PingService's
+	// SendBatchUpstream RPC.
+	PingServiceSendBatchUpstreamProcedure = "/ping.PingService/SendBatchUpstream"
+	// PingServiceServerInfoProcedure is the fully-qualified name of the PingService's ServerInfo RPC.
+	PingServiceServerInfoProcedure = "/ping.PingService/ServerInfo"
+	// PingServiceBroadcastProcedure is the fully-qualified name of the PingService's Broadcast RPC.
+	PingServiceBroadcastProcedure = "/ping.PingService/Broadcast"
+)
+
+// PingServiceClient is a client for the ping.PingService service.
+type PingServiceClient interface {
+	Send(context.Context, *connect_go.Request[v1.Request]) (*connect_go.Response[v1.Response], error)
+	SendUpstream(context.Context, *connect_go.Request[v1.Request]) (*connect_go.Response[v1.Response], error)
+	Subscribe(context.Context, *connect_go.Request[v1.SubscribeRequest]) (*connect_go.ServerStreamForClient[v1.Response], error)
+	PingPong(context.Context) *connect_go.BidiStreamForClient[v1.Request, v1.Response]
+	SendBatch(context.Context) *connect_go.ClientStreamForClient[v1.Request, v1.BatchResponse]
+	SubscribeUpstream(context.Context, *connect_go.Request[v1.SubscribeRequest]) (*connect_go.ServerStreamForClient[v1.Response], error)
+	PingPongUpstream(context.Context) *connect_go.BidiStreamForClient[v1.Request, v1.Response]
+	SendBatchUpstream(context.Context) *connect_go.ClientStreamForClient[v1.Request, v1.BatchResponse]
+	ServerInfo(context.Context, *connect_go.Request[v1.ServerInfoRequest]) (*connect_go.Response[v1.ServerInfoResponse], error)
+	// Broadcast relays the request to every upstream service and reports the result of each.
+	Broadcast(context.Context, *connect_go.Request[v1.BroadcastRequest]) (*connect_go.Response[v1.BroadcastResponse], error)
+}
+
+// NewPingServiceClient constructs a client for the ping.PingService service. By default, it uses
+// the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewPingServiceClient(httpClient connect_go.HTTPClient, baseURL string, opts ...connect_go.ClientOption) PingServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &pingServiceClient{
+		send: connect_go.NewClient[v1.Request, v1.Response](
+			httpClient,
+			baseURL+PingServiceSendProcedure,
+			opts...,
+		),
+		sendUpstream: connect_go.NewClient[v1.Request, v1.Response](
+			httpClient,
+			baseURL+PingServiceSendUpstreamProcedure,
+			opts...,
+		),
+		subscribe: connect_go.NewClient[v1.SubscribeRequest, v1.Response](
+			httpClient,
+			baseURL+PingServiceSubscribeProcedure,
+			opts...,
+		),
+		pingPong: connect_go.NewClient[v1.Request, v1.Response](
+			httpClient,
+			baseURL+PingServicePingPongProcedure,
+			opts...,
+		),
+		sendBatch: connect_go.NewClient[v1.Request, v1.BatchResponse](
+			httpClient,
+			baseURL+PingServiceSendBatchProcedure,
+			opts...,
+		),
+		subscribeUpstream: connect_go.NewClient[v1.SubscribeRequest, v1.Response](
+			httpClient,
+			baseURL+PingServiceSubscribeUpstreamProcedure,
+			opts...,
+		),
+		pingPongUpstream: connect_go.NewClient[v1.Request, v1.Response](
+			httpClient,
+			baseURL+PingServicePingPongUpstreamProcedure,
+			opts...,
+		),
+		sendBatchUpstream: connect_go.NewClient[v1.Request, v1.BatchResponse](
+			httpClient,
+			baseURL+PingServiceSendBatchUpstreamProcedure,
+			opts...,
+		),
+		serverInfo: connect_go.NewClient[v1.ServerInfoRequest, v1.ServerInfoResponse](
+			httpClient,
+			baseURL+PingServiceServerInfoProcedure,
+			opts...,
+		),
+		broadcast: connect_go.NewClient[v1.BroadcastRequest, v1.BroadcastResponse](
+			httpClient,
+			baseURL+PingServiceBroadcastProcedure,
+			opts...,
+		),
+	}
+}
+
+// pingServiceClient implements PingServiceClient.
+type pingServiceClient struct {
+	send              *connect_go.Client[v1.Request, v1.Response]
+	sendUpstream      *connect_go.Client[v1.Request, v1.Response]
+	subscribe         *connect_go.Client[v1.SubscribeRequest, v1.Response]
+	pingPong          *connect_go.Client[v1.Request, v1.Response]
+	sendBatch         *connect_go.Client[v1.Request, v1.BatchResponse]
+	subscribeUpstream *connect_go.Client[v1.SubscribeRequest, v1.Response]
+	pingPongUpstream  *connect_go.Client[v1.Request, v1.Response]
+	sendBatchUpstream *connect_go.Client[v1.Request, v1.BatchResponse]
+	serverInfo        *connect_go.Client[v1.ServerInfoRequest, v1.ServerInfoResponse]
+	broadcast         *connect_go.Client[v1.BroadcastRequest, v1.BroadcastResponse]
+}
+
+// Send calls ping.PingService.Send.
+func (c *pingServiceClient) Send(ctx context.Context, req *connect_go.Request[v1.Request]) (*connect_go.Response[v1.Response], error) {
+	return c.send.CallUnary(ctx, req)
+}
+
+// SendUpstream calls ping.PingService.SendUpstream.
+func (c *pingServiceClient) SendUpstream(ctx context.Context, req *connect_go.Request[v1.Request]) (*connect_go.Response[v1.Response], error) {
+	return c.sendUpstream.CallUnary(ctx, req)
+}
+
+// Subscribe calls ping.PingService.Subscribe.
+func (c *pingServiceClient) Subscribe(ctx context.Context, req *connect_go.Request[v1.SubscribeRequest]) (*connect_go.ServerStreamForClient[v1.Response], error) {
+	return c.subscribe.CallServerStream(ctx, req)
+}
+
+// PingPong calls ping.PingService.PingPong.
+func (c *pingServiceClient) PingPong(ctx context.Context) *connect_go.BidiStreamForClient[v1.Request, v1.Response] {
+	return c.pingPong.CallBidiStream(ctx)
+}
+
+// SendBatch calls ping.PingService.SendBatch.
+func (c *pingServiceClient) SendBatch(ctx context.Context) *connect_go.ClientStreamForClient[v1.Request, v1.BatchResponse] {
+	return c.sendBatch.CallClientStream(ctx)
+}
+
+// SubscribeUpstream calls ping.PingService.SubscribeUpstream.
+func (c *pingServiceClient) SubscribeUpstream(ctx context.Context, req *connect_go.Request[v1.SubscribeRequest]) (*connect_go.ServerStreamForClient[v1.Response], error) {
+	return c.subscribeUpstream.CallServerStream(ctx, req)
+}
+
+// PingPongUpstream calls ping.PingService.PingPongUpstream.
+func (c *pingServiceClient) PingPongUpstream(ctx context.Context) *connect_go.BidiStreamForClient[v1.Request, v1.Response] {
+	return c.pingPongUpstream.CallBidiStream(ctx)
+}
+
+// SendBatchUpstream calls ping.PingService.SendBatchUpstream.
+func (c *pingServiceClient) SendBatchUpstream(ctx context.Context) *connect_go.ClientStreamForClient[v1.Request, v1.BatchResponse] {
+	return c.sendBatchUpstream.CallClientStream(ctx)
+}
+
+// ServerInfo calls ping.PingService.ServerInfo.
+func (c *pingServiceClient) ServerInfo(ctx context.Context, req *connect_go.Request[v1.ServerInfoRequest]) (*connect_go.Response[v1.ServerInfoResponse], error) {
+	return c.serverInfo.CallUnary(ctx, req)
+}
+
+// Broadcast calls ping.PingService.Broadcast.
+func (c *pingServiceClient) Broadcast(ctx context.Context, req *connect_go.Request[v1.BroadcastRequest]) (*connect_go.Response[v1.BroadcastResponse], error) {
+	return c.broadcast.CallUnary(ctx, req)
+}
+
+// PingServiceHandler is an implementation of the ping.PingService service.
+type PingServiceHandler interface {
+	Send(context.Context, *connect_go.Request[v1.Request]) (*connect_go.Response[v1.Response], error)
+	SendUpstream(context.Context, *connect_go.Request[v1.Request]) (*connect_go.Response[v1.Response], error)
+	Subscribe(context.Context, *connect_go.Request[v1.SubscribeRequest], *connect_go.ServerStream[v1.Response]) error
+	PingPong(context.Context, *connect_go.BidiStream[v1.Request, v1.Response]) error
+	SendBatch(context.Context, *connect_go.ClientStream[v1.Request]) (*connect_go.Response[v1.BatchResponse], error)
+	SubscribeUpstream(context.Context, *connect_go.Request[v1.SubscribeRequest], *connect_go.ServerStream[v1.Response]) error
+	PingPongUpstream(context.Context, *connect_go.BidiStream[v1.Request, v1.Response]) error
+	SendBatchUpstream(context.Context, *connect_go.ClientStream[v1.Request]) (*connect_go.Response[v1.BatchResponse], error)
+	ServerInfo(context.Context, *connect_go.Request[v1.ServerInfoRequest]) (*connect_go.Response[v1.ServerInfoResponse], error)
+	// Broadcast relays the request to every upstream service and reports the result of each.
+	Broadcast(context.Context, *connect_go.Request[v1.BroadcastRequest]) (*connect_go.Response[v1.BroadcastResponse], error)
+}
+
+// NewPingServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewPingServiceHandler(svc PingServiceHandler, opts ...connect_go.HandlerOption) (string, http.Handler) {
+	pingServiceSendHandler := connect_go.NewUnaryHandler(
+		PingServiceSendProcedure,
+		svc.Send,
+		opts...,
+	)
+	pingServiceSendUpstreamHandler := connect_go.NewUnaryHandler(
+		PingServiceSendUpstreamProcedure,
+		svc.SendUpstream,
+		opts...,
+	)
+	pingServiceSubscribeHandler := connect_go.NewServerStreamHandler(
+		PingServiceSubscribeProcedure,
+		svc.Subscribe,
+		opts...,
+	)
+	pingServicePingPongHandler := connect_go.NewBidiStreamHandler(
+		PingServicePingPongProcedure,
+		svc.PingPong,
+		opts...,
+	)
+	pingServiceSendBatchHandler := connect_go.NewClientStreamHandler(
+		PingServiceSendBatchProcedure,
+		svc.SendBatch,
+		opts...,
+	)
+	pingServiceSubscribeUpstreamHandler := connect_go.NewServerStreamHandler(
+		PingServiceSubscribeUpstreamProcedure,
+		svc.SubscribeUpstream,
+		opts...,
+	)
+	pingServicePingPongUpstreamHandler := connect_go.NewBidiStreamHandler(
+		PingServicePingPongUpstreamProcedure,
+		svc.PingPongUpstream,
+		opts...,
+	)
+	pingServiceSendBatchUpstreamHandler := connect_go.NewClientStreamHandler(
+		PingServiceSendBatchUpstreamProcedure,
+		svc.SendBatchUpstream,
+		opts...,
+	)
+	pingServiceServerInfoHandler := connect_go.NewUnaryHandler(
+		PingServiceServerInfoProcedure,
+		svc.ServerInfo,
+		opts...,
+	)
+	pingServiceBroadcastHandler := connect_go.NewUnaryHandler(
+		PingServiceBroadcastProcedure,
+		svc.Broadcast,
+		opts...,
+	)
+	return "/ping.PingService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case PingServiceSendProcedure:
+			pingServiceSendHandler.ServeHTTP(w, r)
+		case PingServiceSendUpstreamProcedure:
+			pingServiceSendUpstreamHandler.ServeHTTP(w, r)
+		case PingServiceSubscribeProcedure:
+			pingServiceSubscribeHandler.ServeHTTP(w, r)
+		case PingServicePingPongProcedure:
+			pingServicePingPongHandler.ServeHTTP(w, r)
+		case PingServiceSendBatchProcedure:
+			pingServiceSendBatchHandler.ServeHTTP(w, r)
+		case PingServiceSubscribeUpstreamProcedure:
+			pingServiceSubscribeUpstreamHandler.ServeHTTP(w, r)
+		case PingServicePingPongUpstreamProcedure:
+			pingServicePingPongUpstreamHandler.ServeHTTP(w, r)
+		case PingServiceSendBatchUpstreamProcedure:
+			pingServiceSendBatchUpstreamHandler.ServeHTTP(w, r)
+		case PingServiceServerInfoProcedure:
+			pingServiceServerInfoHandler.ServeHTTP(w, r)
+		case PingServiceBroadcastProcedure:
+			pingServiceBroadcastHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedPingServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedPingServiceHandler struct{}
+
+func (UnimplementedPingServiceHandler) Send(context.Context, *connect_go.Request[v1.Request]) (*connect_go.Response[v1.Response], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.Send is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) SendUpstream(context.Context, *connect_go.Request[v1.Request]) (*connect_go.Response[v1.Response], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.SendUpstream is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) Subscribe(context.Context, *connect_go.Request[v1.SubscribeRequest], *connect_go.ServerStream[v1.Response]) error {
+	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.Subscribe is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) PingPong(context.Context, *connect_go.BidiStream[v1.Request, v1.Response]) error {
+	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.PingPong is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) SendBatch(context.Context, *connect_go.ClientStream[v1.Request]) (*connect_go.Response[v1.BatchResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.SendBatch is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) SubscribeUpstream(context.Context, *connect_go.Request[v1.SubscribeRequest], *connect_go.ServerStream[v1.Response]) error {
+	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.SubscribeUpstream is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) PingPongUpstream(context.Context, *connect_go.BidiStream[v1.Request, v1.Response]) error {
+	return connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.PingPongUpstream is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) SendBatchUpstream(context.Context, *connect_go.ClientStream[v1.Request]) (*connect_go.Response[v1.BatchResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.SendBatchUpstream is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) ServerInfo(context.Context, *connect_go.Request[v1.ServerInfoRequest]) (*connect_go.Response[v1.ServerInfoResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.ServerInfo is not implemented"))
+}
+
+func (UnimplementedPingServiceHandler) Broadcast(context.Context, *connect_go.Request[v1.BroadcastRequest]) (*connect_go.Response[v1.BroadcastResponse], error) {
+	return nil, connect_go.NewError(connect_go.CodeUnimplemented, errors.New("ping.PingService.Broadcast is not implemented"))
+}
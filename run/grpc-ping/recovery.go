@@ -0,0 +1,100 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/bufbuild/connect-go"
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// reportedErrorEventType makes Cloud Error Reporting pick up a log entry whose message holds a stack trace.
+// See https://cloud.google.com/error-reporting/docs/formatting-error-messages
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// panicRecovery turns the panics of RPC handlers into Internal errors instead of crashing the instance, and reports
+// them to Cloud Error Reporting and the panics_total metric.
+//
+// Panics of goroutines started by the handlers are not recovered.
+type panicRecovery struct {
+	// service and version identify the reporting service in Cloud Error Reporting, K_SERVICE and K_REVISION.
+	service string
+	version string
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor that recovers the panics of Unary RPCs.
+func (p *panicRecovery) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = p.report(ctx, protocolGRPC, info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is a gRPC server-side interceptor that recovers the panics of Streaming RPCs.
+func (p *panicRecovery) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = p.report(ss.Context(), protocolGRPC, info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// ConnectInterceptor is a Connect handler interceptor that recovers the panics of RPCs.
+func (p *panicRecovery) ConnectInterceptor() connect.Interceptor {
+	return connectInterceptorFunc(func(ctx context.Context, spec connect.Spec, header http.Header, call func(ctx context.Context) error) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = connectError(p.report(ctx, protocolConnect, spec.Procedure, r))
+			}
+		}()
+
+		return call(ctx)
+	})
+}
+
+// report logs the panic r of method, recovered in the goroutine which panicked, and returns the error of the RPC.
+func (p *panicRecovery) report(ctx context.Context, protocol, method string, r interface{}) error {
+	metrics.panicked(protocol, method)
+
+	// Cloud Error Reporting parses the stack trace from the message, in the format of an unrecovered panic.
+	zapcloudlogging.FromContext(ctx).Error(fmt.Sprintf("panic: %v\n\n%s", r, debug.Stack()),
+		zap.String("@type", reportedErrorEventType),
+		zap.Object("serviceContext", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddString("service", p.service)
+			enc.AddString("version", p.version)
+			return nil
+		})),
+	)
+
+	return status.Errorf(codes.Internal, "internal error while serving %s", method)
+}
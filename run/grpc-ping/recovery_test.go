@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPanicRecoveryUnaryServerInterceptor(t *testing.T) {
+	const method = "/ping.PingService/TestUnaryPanic"
+
+	p := &panicRecovery{service: "grpc-ping", version: "test"}
+	ctx := zapcloudlogging.NewContext(context.Background(), zap.NewNop())
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("unary handler panicked")
+	}
+
+	panics := metrics.panics.WithLabelValues(protocolGRPC, method)
+	before := testutil.ToFloat64(panics)
+	_, err := p.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	if got := status.Code(err); got != codes.Internal {
+		t.Errorf("code = %v, want %v: %v", got, codes.Internal, err)
+	}
+	if got := testutil.ToFloat64(panics) - before; got != 1 {
+		t.Errorf("panics increased by %v, want 1", got)
+	}
+}
+
+func TestPanicRecoveryStreamServerInterceptor(t *testing.T) {
+	const method = "/ping.PingService/TestStreamPanic"
+
+	p := &panicRecovery{service: "grpc-ping", version: "test"}
+	ss := &fakeWatchStream{ctx: zapcloudlogging.NewContext(context.Background(), zap.NewNop())}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		panic("stream handler panicked")
+	}
+
+	panics := metrics.panics.WithLabelValues(protocolGRPC, method)
+	before := testutil.ToFloat64(panics)
+	err := p.StreamServerInterceptor()(nil, ss, &grpc.StreamServerInfo{FullMethod: method}, handler)
+	if got := status.Code(err); got != codes.Internal {
+		t.Errorf("code = %v, want %v: %v", got, codes.Internal, err)
+	}
+	if got := testutil.ToFloat64(panics) - before; got != 1 {
+		t.Errorf("panics increased by %v, want 1", got)
+	}
+}
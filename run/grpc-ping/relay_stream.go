@@ -0,0 +1,203 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+)
+
+// The streaming relay methods proxy their stream to the matching method of the upstream ping service.
+//
+// The upstream stream is opened with a context derived from the incoming stream, so when the caller cancels or its
+// deadline expires the upstream stream is canceled too, and the status the upstream service ends its stream with is
+// returned to the caller. The ID token is attached once, when the upstream stream is opened.
+
+// SubscribeUpstream relays a Subscribe stream from the upstream service.
+func (s *pingService) SubscribeUpstream(req *pb.SubscribeRequest, stream pb.PingService_SubscribeUpstreamServer) error {
+	ctx := stream.Context()
+	logger := zapcloudlogging.FromContext(ctx)
+
+	u := primaryUpstream()
+	if u == nil {
+		return errNoUpstream
+	}
+
+	ctx, err := upstreamStreamContext(ctx, u.audience, u.authenticated)
+	if err != nil {
+		logger.Error("upstreamStreamContext", zap.Error(err))
+		return upstreamError(err)
+	}
+
+	upstream, err := pb.NewPingServiceClient(u.conn).Subscribe(ctx, &pb.SubscribeRequest{
+		Message:  relayedMessage(req.GetMessage()),
+		Count:    req.GetCount(),
+		Interval: req.GetInterval(),
+	})
+	if err != nil {
+		logger.Error("Subscribe", zap.Error(err))
+		return upstreamError(err)
+	}
+
+	var relayed int
+	for {
+		resp, err := upstream.Recv()
+		if err == io.EOF {
+			logger.Info("relayed upstream subscription", zap.Int("count", relayed))
+			return nil
+		}
+		if err != nil {
+			logger.Error("could not receive upstream pong", zap.Int("count", relayed), zap.Error(err))
+			return upstreamError(err)
+		}
+
+		resp.Hops = append(resp.Hops, s.info)
+		if err := stream.Send(resp); err != nil {
+			logger.Error("could not relay pong", zap.Int("count", relayed), zap.Error(err))
+			return err
+		}
+		relayed++
+	}
+}
+
+// PingPongUpstream relays a PingPong stream to and from the upstream service.
+func (s *pingService) PingPongUpstream(stream pb.PingService_PingPongUpstreamServer) error {
+	logger := zapcloudlogging.FromContext(stream.Context())
+
+	u := primaryUpstream()
+	if u == nil {
+		return errNoUpstream
+	}
+
+	// Cancel the upstream stream when the relay returns early, e.g. when the caller's stream fails.
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	ctx, err := upstreamStreamContext(ctx, u.audience, u.authenticated)
+	if err != nil {
+		logger.Error("upstreamStreamContext", zap.Error(err))
+		return upstreamError(err)
+	}
+
+	upstream, err := pb.NewPingServiceClient(u.conn).PingPong(ctx)
+	if err != nil {
+		logger.Error("PingPong", zap.Error(err))
+		return upstreamError(err)
+	}
+
+	// Forward pings to the upstream service until the caller closes its side of the stream.
+	sendErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err == io.EOF {
+				sendErr <- upstream.CloseSend()
+				return
+			}
+			if err != nil {
+				sendErr <- err
+				return
+			}
+
+			// A failed Send means the upstream stream ended, its status is returned by upstream.Recv.
+			if err := upstream.Send(&pb.Request{Message: relayedMessage(req.GetMessage())}); err != nil {
+				sendErr <- nil
+				return
+			}
+		}
+	}()
+
+	var relayed int
+	for {
+		resp, err := upstream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Error("could not receive upstream pong", zap.Int("count", relayed), zap.Error(err))
+			return upstreamError(err)
+		}
+
+		resp.Hops = append(resp.Hops, s.info)
+		if err := stream.Send(resp); err != nil {
+			logger.Error("could not relay pong", zap.Int("count", relayed), zap.Error(err))
+			return err
+		}
+		relayed++
+	}
+	if err := <-sendErr; err != nil {
+		logger.Error("could not relay ping", zap.Int("count", relayed), zap.Error(err))
+		return err
+	}
+
+	logger.Info("relayed upstream ping pong", zap.Int("count", relayed))
+	return nil
+}
+
+// SendBatchUpstream relays a SendBatch stream to the upstream service.
+func (s *pingService) SendBatchUpstream(stream pb.PingService_SendBatchUpstreamServer) error {
+	logger := zapcloudlogging.FromContext(stream.Context())
+
+	u := primaryUpstream()
+	if u == nil {
+		return errNoUpstream
+	}
+
+	ctx, err := upstreamStreamContext(stream.Context(), u.audience, u.authenticated)
+	if err != nil {
+		logger.Error("upstreamStreamContext", zap.Error(err))
+		return upstreamError(err)
+	}
+
+	upstream, err := pb.NewPingServiceClient(u.conn).SendBatch(ctx)
+	if err != nil {
+		logger.Error("SendBatch", zap.Error(err))
+		return upstreamError(err)
+	}
+
+	var relayed int
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Returning cancels ctx, which aborts the upstream stream as well.
+			logger.Error("could not receive ping", zap.Int("count", relayed), zap.Error(err))
+			return err
+		}
+
+		// A failed Send means the upstream stream ended, its status is returned by CloseAndRecv.
+		if err := upstream.Send(&pb.Request{Message: relayedMessage(req.GetMessage())}); err != nil {
+			break
+		}
+		relayed++
+	}
+
+	resp, err := upstream.CloseAndRecv()
+	if err != nil {
+		logger.Error("could not receive upstream batch response", zap.Int("count", relayed), zap.Error(err))
+		return upstreamError(err)
+	}
+
+	logger.Info("relayed upstream batch", zap.Int("count", relayed))
+	resp.Hops = append(resp.Hops, s.info)
+	return stream.SendAndClose(resp)
+}
@@ -24,18 +24,40 @@ import (
 )
 
 // pingRequest sends a new gRPC ping request to the server configured in the connection.
-func pingRequest(conn *grpc.ClientConn, p *pb.Request) (*pb.Response, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
+func pingRequest(ctx context.Context, conn *grpc.ClientConn, p *pb.Request) (*pb.Response, error) {
 	client := pb.NewPingServiceClient(conn)
 	return client.Send(ctx, p)
 }
 
 // PingRequest creates a new gRPC request to the upstream ping gRPC service.
-func PingRequest(conn *grpc.ClientConn, p *pb.Request, url string, authenticated bool) (*pb.Response, error) {
+// ctx is the context of the incoming request, its cancellation and trace are forwarded upstream,
+// in both the traceparent and X-Cloud-Trace-Context headers.
+// Slow attempts are hedged with upstreamHedge, and failed attempts retried with upstreamRetry within 30 seconds.
+func PingRequest(ctx context.Context, conn *grpc.ClientConn, p *pb.Request, url string, authenticated bool) (*pb.Response, error) {
+	ctx, cancel := context.WithTimeout(withCallerContext(ctx), 30*time.Second)
+	defer cancel()
+
+	ctx = withOutgoingCloudTraceContext(ctx)
+	var resp *pb.Response
+	err := upstreamRetry.do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = hedged(ctx, upstreamHedge, func(ctx context.Context) (*pb.Response, error) {
+			if authenticated {
+				return pingRequestWithAuth(ctx, conn, p, url)
+			}
+			return pingRequest(ctx, conn, p)
+		})
+		return err
+	})
+	return resp, err
+}
+
+// upstreamStreamContext returns the context of a stream relayed to the upstream ping gRPC service.
+// It derives from the context of the incoming stream, so the caller's cancellation and deadline are forwarded upstream.
+func upstreamStreamContext(ctx context.Context, url string, authenticated bool) (context.Context, error) {
+	ctx = withOutgoingCloudTraceContext(withCallerContext(ctx))
 	if authenticated {
-		return pingRequestWithAuth(conn, p, url)
+		return withIDToken(ctx, url)
 	}
-	return pingRequest(conn, p)
+	return ctx, nil
 }
@@ -16,40 +16,39 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"time"
 
-	"google.golang.org/api/idtoken"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 
 	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
 )
 
-// pingRequestWithAuth mints a new Identity Token for each request.
-// This token has a 1 hour expiry and should be reused.
+// pingRequestWithAuth sends a request carrying an Identity Token.
+// Tokens have a 1 hour expiry and are reused through the idTokens cache.
 // audience must be the auto-assigned URL of a Cloud Run service or HTTP Cloud Function without port number.
-func pingRequestWithAuth(conn *grpc.ClientConn, p *pb.Request, audience string) (*pb.Response, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Create an identity token.
-	// With a global TokenSource tokens would be reused and auto-refreshed at need.
-	// A given TokenSource is specific to the audience.
-	tokenSource, err := idtoken.NewTokenSource(ctx, audience)
+func pingRequestWithAuth(ctx context.Context, conn *grpc.ClientConn, p *pb.Request, audience string) (*pb.Response, error) {
+	ctx, err := withIDToken(ctx, audience)
 	if err != nil {
-		return nil, fmt.Errorf("idtoken.NewTokenSource: %v", err)
-	}
-	token, err := tokenSource.Token()
-	if err != nil {
-		return nil, fmt.Errorf("TokenSource.Token: %v", err)
+		return nil, err
 	}
 
-	// Add token to gRPC Request.
-	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token.AccessToken)
-
 	// Send the request.
 	client := pb.NewPingServiceClient(conn)
 
 	return client.Send(ctx, p)
 }
+
+// withIDToken returns a copy of ctx which carries an Identity Token for audience in its outgoing gRPC metadata.
+// Streams call it once when they are opened, the token then authenticates the whole stream.
+func withIDToken(ctx context.Context, audience string) (context.Context, error) {
+	// Get an identity token for the audience, reused until shortly before it expires.
+	token, err := idTokens.Token(ctx, audience)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("got ID token", zap.String("audience", audience), zap.Object("idTokenCache", idTokens.Stats()))
+
+	// Add token to gRPC Request.
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token.AccessToken), nil
+}
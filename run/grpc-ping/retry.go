@@ -0,0 +1,309 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// The GRPC_PING_RETRY_MODE environment variable selects how requests to the upstream service are retried.
+const (
+	// retryModeLoop retries unary requests in PingRequest. It supports the per-attempt timeout.
+	retryModeLoop = "loop"
+
+	// retryModeServiceConfig retries requests with the retry policy of the gRPC service config of the connection,
+	// streams too as long as they did not receive a response. The per-attempt timeout is not supported.
+	retryModeServiceConfig = "service-config"
+)
+
+// attemptsHeader is the response metadata holding the number of attempts made to the upstream service.
+const attemptsHeader = "x-upstream-attempts"
+
+// upstreamRetry is the retry policy of the requests to the upstream service.
+var upstreamRetry = defaultRetryPolicy()
+
+// retryPolicy retries requests failing with one of the retryable codes, waiting for an exponential backoff with
+// jitter between attempts, like the gRPC retry policy does.
+type retryPolicy struct {
+	mode string
+
+	// maxAttempts is the number of attempts, including the first one. Requests are not retried if it is 1.
+	maxAttempts       int
+	initialBackoff    time.Duration
+	maxBackoff        time.Duration
+	backoffMultiplier float64
+	retryableCodes    []codes.Code
+
+	// attemptTimeout is the timeout of each attempt, within the deadline of the request, if not zero.
+	// It is not set by default: an upstream instance starting from zero may take most of the deadline to answer.
+	attemptTimeout time.Duration
+}
+
+func defaultRetryPolicy() *retryPolicy {
+	return &retryPolicy{
+		mode:              retryModeLoop,
+		maxAttempts:       3,
+		initialBackoff:    100 * time.Millisecond,
+		maxBackoff:        time.Second,
+		backoffMultiplier: 2,
+		retryableCodes:    []codes.Code{codes.Unavailable},
+	}
+}
+
+// retryPolicyFromEnv returns the default retry policy, overridden by the GRPC_PING_RETRY_* environment variables.
+func retryPolicyFromEnv() (*retryPolicy, error) {
+	p := defaultRetryPolicy()
+
+	if v := os.Getenv("GRPC_PING_RETRY_MODE"); v != "" {
+		if v != retryModeLoop && v != retryModeServiceConfig {
+			return nil, fmt.Errorf("invalid GRPC_PING_RETRY_MODE %q: must be %q or %q", v, retryModeLoop, retryModeServiceConfig)
+		}
+		p.mode = v
+	}
+	if v := os.Getenv("GRPC_PING_RETRY_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid GRPC_PING_RETRY_MAX_ATTEMPTS %q: must be a positive number", v)
+		}
+		p.maxAttempts = n
+	}
+	durations := []struct {
+		env string
+		d   *time.Duration
+	}{
+		{"GRPC_PING_RETRY_INITIAL_BACKOFF", &p.initialBackoff},
+		{"GRPC_PING_RETRY_MAX_BACKOFF", &p.maxBackoff},
+		{"GRPC_PING_RETRY_ATTEMPT_TIMEOUT", &p.attemptTimeout},
+	}
+	for _, d := range durations {
+		if v := os.Getenv(d.env); v != "" {
+			var err error
+			if *d.d, err = time.ParseDuration(v); err != nil || *d.d < 0 {
+				return nil, fmt.Errorf("invalid %s %q: must be a duration", d.env, v)
+			}
+		}
+	}
+	if v := os.Getenv("GRPC_PING_RETRY_BACKOFF_MULTIPLIER"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 1 {
+			return nil, fmt.Errorf("invalid GRPC_PING_RETRY_BACKOFF_MULTIPLIER %q: must be a number >= 1", v)
+		}
+		p.backoffMultiplier = f
+	}
+	if v := splitList(os.Getenv("GRPC_PING_RETRY_CODES")); len(v) > 0 {
+		p.retryableCodes = nil
+		for _, name := range v {
+			var code codes.Code
+			if err := code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err != nil || code == codes.OK {
+				return nil, fmt.Errorf("invalid GRPC_PING_RETRY_CODES %q: must be status code names, e.g. UNAVAILABLE", name)
+			}
+			p.retryableCodes = append(p.retryableCodes, code)
+		}
+	}
+	if p.mode == retryModeServiceConfig {
+		// gRPC silently caps the attempts of its retry policy, reject what would not be honored.
+		if p.maxAttempts > 5 {
+			return nil, fmt.Errorf("invalid GRPC_PING_RETRY_MAX_ATTEMPTS %d: the service config retry policy allows 5 attempts at most", p.maxAttempts)
+		}
+		if p.initialBackoff <= 0 || p.maxBackoff <= 0 {
+			return nil, fmt.Errorf("invalid GRPC_PING_RETRY_INITIAL_BACKOFF or GRPC_PING_RETRY_MAX_BACKOFF: the service config retry policy requires backoffs > 0")
+		}
+	}
+
+	return p, nil
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (p *retryPolicy) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("mode", p.mode)
+	enc.AddInt("max_attempts", p.maxAttempts)
+	enc.AddDuration("initial_backoff", p.initialBackoff)
+	enc.AddDuration("max_backoff", p.maxBackoff)
+	enc.AddFloat64("backoff_multiplier", p.backoffMultiplier)
+	enc.AddString("retryable_codes", fmt.Sprint(p.retryableCodes))
+	enc.AddDuration("attempt_timeout", p.attemptTimeout)
+	return nil
+}
+
+// DialOptions returns the options of the connection to an upstream service applying p: the counting of the attempts
+// in every mode, and its service config retry policy in retryModeServiceConfig if the upstream is primary, the only one
+// whose requests are retried. The others only serve Broadcast, which makes a single attempt.
+func (p *retryPolicy) DialOptions(primary bool) []grpc.DialOption {
+	opts := []grpc.DialOption{grpc.WithStatsHandler(attemptCounter{})}
+	if primary && p.mode == retryModeServiceConfig && p.maxAttempts > 1 {
+		opts = append(opts, grpc.WithDefaultServiceConfig(p.serviceConfig()))
+	}
+	return opts
+}
+
+// serviceConfig returns the gRPC service config applying p to every method of PingService.
+// See https://github.com/grpc/grpc/blob/master/doc/service_config.md
+func (p *retryPolicy) serviceConfig() string {
+	codeNames := make([]string, 0, len(p.retryableCodes))
+	for _, code := range p.retryableCodes {
+		codeNames = append(codeNames, canonicalCodeNames[code])
+	}
+	seconds := func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+	}
+
+	config := map[string]interface{}{
+		"methodConfig": []interface{}{map[string]interface{}{
+			"name": []interface{}{map[string]string{"service": "ping.PingService"}},
+			"retryPolicy": map[string]interface{}{
+				"maxAttempts":          p.maxAttempts,
+				"initialBackoff":       seconds(p.initialBackoff),
+				"maxBackoff":           seconds(p.maxBackoff),
+				"backoffMultiplier":    p.backoffMultiplier,
+				"retryableStatusCodes": codeNames,
+			},
+		}},
+	}
+	b, _ := json.Marshal(config)
+	return string(b)
+}
+
+// canonicalCodeNames are the names of the status codes in service configs, which codes.Code.String does not return.
+var canonicalCodeNames = [...]string{
+	codes.OK:                 "OK",
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
+
+// retryable reports whether an attempt failing with err may be retried. ctx is the context of the whole request:
+// an attempt which timed out is retried if the request did not. Requests rejected by an open circuit are not retried,
+// the circuit stays open longer than the backoff.
+func (p *retryPolicy) retryable(ctx context.Context, err error) bool {
+	if isCircuitOpen(err) {
+		return false
+	}
+	code := status.Code(err)
+	if code == codes.DeadlineExceeded && p.attemptTimeout > 0 && ctx.Err() == nil {
+		return true
+	}
+	for _, c := range p.retryableCodes {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
+// do calls call until it succeeds, fails with an error which is not retryable, p.maxAttempts is reached, or ctx is
+// done. In retryModeServiceConfig gRPC retries instead and call is called once.
+func (p *retryPolicy) do(ctx context.Context, call func(ctx context.Context) error) error {
+	if p.mode != retryModeLoop {
+		return call(ctx)
+	}
+
+	logger := zapcloudlogging.FromContext(ctx)
+	backoff := p.initialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.attemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, p.attemptTimeout)
+		}
+		err := call(attemptCtx)
+		cancel()
+		if err == nil || attempt >= p.maxAttempts || !p.retryable(ctx, err) {
+			return err
+		}
+
+		// Full jitter, like gRPC, so instances scaling from zero are not hit by synchronized retries.
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		logger.Warn("retrying upstream request", zap.Int("attempt", attempt), zap.Duration("backoff", wait), zap.Error(err))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = time.Duration(float64(backoff) * p.backoffMultiplier)
+		if backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+type attemptsKey struct{}
+
+// withAttemptCounter returns a copy of ctx counting the attempts of the upstream requests made with it,
+// and the counter.
+func withAttemptCounter(ctx context.Context) (context.Context, *atomic.Int32) {
+	n := &atomic.Int32{}
+	return context.WithValue(ctx, attemptsKey{}, n), n
+}
+
+// attemptCounter is a stats.Handler counting the attempts of the requests whose context has a counter, see
+// withAttemptCounter. It sees the attempts of the service config retry policy, which are invisible otherwise.
+type attemptCounter struct{}
+
+// TagRPC implements stats.Handler.
+func (attemptCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC implements stats.Handler.
+func (attemptCounter) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	// Transparent retries are made by gRPC when the request never left the client, they are not attempts of the policy.
+	if begin, ok := s.(*stats.Begin); ok && !begin.IsTransparentRetryAttempt {
+		if n, ok := ctx.Value(attemptsKey{}).(*atomic.Int32); ok {
+			n.Add(1)
+		}
+	}
+}
+
+// TagConn implements stats.Handler.
+func (attemptCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (attemptCounter) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,269 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	zapcloudlogging "github.com/zchee/zap-cloudlogging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testRetryPolicy returns the default retry policy with backoffs short enough for tests.
+func testRetryPolicy() *retryPolicy {
+	p := defaultRetryPolicy()
+	p.initialBackoff = time.Millisecond
+	p.maxBackoff = time.Millisecond
+	return p
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{
+			name:         "retryable",
+			err:          status.Error(codes.Unavailable, "unavailable"),
+			wantAttempts: 3,
+		},
+		{
+			name:         "not retryable",
+			err:          status.Error(codes.InvalidArgument, "invalid argument"),
+			wantAttempts: 1,
+		},
+		{
+			name:         "deadline exceeded without attempt timeout",
+			err:          status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+			wantAttempts: 1,
+		},
+		{
+			name:         "circuit open",
+			err:          circuitOpenError(time.Second),
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := zapcloudlogging.NewContext(context.Background(), zap.NewNop())
+
+			attempts := 0
+			err := testRetryPolicy().do(ctx, func(ctx context.Context) error {
+				attempts++
+				return tt.err
+			})
+			if status.Code(err) != status.Code(tt.err) {
+				t.Errorf("do() = %v, want %v", err, tt.err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoSucceeds(t *testing.T) {
+	ctx := zapcloudlogging.NewContext(context.Background(), zap.NewNop())
+
+	attempts := 0
+	err := testRetryPolicy().do(ctx, func(ctx context.Context) error {
+		attempts++
+		if attempts < 2 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("do() = %v, want success", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+}
+
+func TestRetryPolicyDoAttemptTimeout(t *testing.T) {
+	// wait blocks until the attempt is done, like an upstream which does not answer.
+	wait := func(attempts *int) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			*attempts++
+			<-ctx.Done()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	t.Run("request alive", func(t *testing.T) {
+		ctx := zapcloudlogging.NewContext(context.Background(), zap.NewNop())
+		p := testRetryPolicy()
+		p.attemptTimeout = 10 * time.Millisecond
+
+		attempts := 0
+		err := p.do(ctx, wait(&attempts))
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("do() = %v, want DeadlineExceeded", err)
+		}
+		if attempts != p.maxAttempts {
+			t.Errorf("attempts = %d, want %d", attempts, p.maxAttempts)
+		}
+	})
+
+	t.Run("request timed out", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		ctx = zapcloudlogging.NewContext(ctx, zap.NewNop())
+		p := testRetryPolicy()
+		p.attemptTimeout = time.Hour
+
+		attempts := 0
+		err := p.do(ctx, wait(&attempts))
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("do() = %v, want DeadlineExceeded", err)
+		}
+		if attempts != 1 {
+			t.Errorf("attempts = %d, want 1", attempts)
+		}
+	})
+}
+
+func TestRetryPolicyDoBackoffWithinDeadline(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctx = zapcloudlogging.NewContext(ctx, zap.NewNop())
+	p := defaultRetryPolicy()
+	p.initialBackoff = time.Hour
+	p.maxBackoff = time.Hour
+
+	start := time.Now()
+	err := p.do(ctx, func(ctx context.Context) error {
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("do() = %v, want the error of the attempt", err)
+	}
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		t.Errorf("do() returned after %v, want no backoff past the deadline of %v", elapsed, timeout)
+	}
+}
+
+func TestRetryPolicyServiceConfig(t *testing.T) {
+	p := defaultRetryPolicy()
+	p.mode = retryModeServiceConfig
+	p.initialBackoff = 100 * time.Millisecond
+	p.maxBackoff = 1500 * time.Millisecond
+	p.retryableCodes = []codes.Code{codes.Unavailable, codes.Canceled}
+
+	var config struct {
+		MethodConfig []struct {
+			RetryPolicy struct {
+				MaxAttempts          int
+				InitialBackoff       string
+				MaxBackoff           string
+				BackoffMultiplier    float64
+				RetryableStatusCodes []string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(p.serviceConfig()), &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.MethodConfig) != 1 {
+		t.Fatalf("method configs = %d, want 1", len(config.MethodConfig))
+	}
+	rp := config.MethodConfig[0].RetryPolicy
+	if rp.MaxAttempts != 3 || rp.BackoffMultiplier != 2 {
+		t.Errorf("maxAttempts, backoffMultiplier = %d, %v, want 3, 2", rp.MaxAttempts, rp.BackoffMultiplier)
+	}
+	if rp.InitialBackoff != "0.1s" || rp.MaxBackoff != "1.5s" {
+		t.Errorf("initialBackoff, maxBackoff = %q, %q, want \"0.1s\", \"1.5s\"", rp.InitialBackoff, rp.MaxBackoff)
+	}
+	if got, want := strings.Join(rp.RetryableStatusCodes, ","), "UNAVAILABLE,CANCELLED"; got != want {
+		t.Errorf("retryableStatusCodes = %s, want %s", got, want)
+	}
+}
+
+func TestRetryPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "loop with many attempts",
+			env:  map[string]string{"GRPC_PING_RETRY_MAX_ATTEMPTS": "6"},
+		},
+		{
+			name: "service config",
+			env:  map[string]string{"GRPC_PING_RETRY_MODE": "service-config", "GRPC_PING_RETRY_MAX_ATTEMPTS": "5"},
+		},
+		{
+			name:    "service config with too many attempts",
+			env:     map[string]string{"GRPC_PING_RETRY_MODE": "service-config", "GRPC_PING_RETRY_MAX_ATTEMPTS": "6"},
+			wantErr: true,
+		},
+		{
+			name:    "service config without initial backoff",
+			env:     map[string]string{"GRPC_PING_RETRY_MODE": "service-config", "GRPC_PING_RETRY_INITIAL_BACKOFF": "0s"},
+			wantErr: true,
+		},
+		{
+			name:    "service config without max backoff",
+			env:     map[string]string{"GRPC_PING_RETRY_MODE": "service-config", "GRPC_PING_RETRY_MAX_BACKOFF": "0s"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			env:     map[string]string{"GRPC_PING_RETRY_MODE": "hedge"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown code",
+			env:     map[string]string{"GRPC_PING_RETRY_CODES": "unavailable,sometimes"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{
+				"GRPC_PING_RETRY_MODE",
+				"GRPC_PING_RETRY_MAX_ATTEMPTS",
+				"GRPC_PING_RETRY_INITIAL_BACKOFF",
+				"GRPC_PING_RETRY_MAX_BACKOFF",
+				"GRPC_PING_RETRY_ATTEMPT_TIMEOUT",
+				"GRPC_PING_RETRY_BACKOFF_MULTIPLIER",
+				"GRPC_PING_RETRY_CODES",
+			} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			_, err := retryPolicyFromEnv()
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("retryPolicyFromEnv() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
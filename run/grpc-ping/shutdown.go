@@ -0,0 +1,170 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// defaultDrainTimeout is how long in-flight RPCs may take to finish after SIGTERM.
+// Cloud Run kills the container 10 seconds after sending SIGTERM, leave some time to clean up.
+const defaultDrainTimeout = 8 * time.Second
+
+// requestTracker counts the RPCs handled by the server.
+type requestTracker struct {
+	inFlight atomic.Int64
+	total    atomic.Int64
+}
+
+func (t *requestTracker) start() {
+	t.inFlight.Add(1)
+	t.total.Add(1)
+}
+
+func (t *requestTracker) done() {
+	t.inFlight.Add(-1)
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor that tracks Unary RPCs, except those of the health and
+// reflection services.
+func (t *requestTracker) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isInfrastructureMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		t.start()
+		defer t.done()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is a gRPC server-side interceptor that tracks Streaming RPCs, except those of the health
+// and reflection services.
+func (t *requestTracker) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isInfrastructureMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		t.start()
+		defer t.done()
+
+		return handler(srv, ss)
+	}
+}
+
+// ConnectInterceptor is a Connect handler interceptor that tracks RPCs.
+func (t *requestTracker) ConnectInterceptor() connect.Interceptor {
+	return connectInterceptorFunc(func(ctx context.Context, spec connect.Spec, header http.Header, call func(ctx context.Context) error) error {
+		t.start()
+		defer t.done()
+
+		return call(ctx)
+	})
+}
+
+// wait blocks until no RPC is in flight, or ctx is done.
+func (t *requestTracker) wait(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for t.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// traceFlushTimeout is how long shutdown waits for the pending spans to be exported.
+const traceFlushTimeout = time.Second
+
+// drainPollInterval is how often requestTracker.wait checks for in-flight RPCs.
+const drainPollInterval = 10 * time.Millisecond
+
+// shutdown reports the server NOT_SERVING and stops httpSrv, letting in-flight requests finish for up to drainTimeout
+// before canceling them. It then stops gsrv, closes the upstream connection, logs a summary and flushes the logger.
+//
+// gsrv serves its RPCs through httpSrv: grpc.Server.GracefulStop does not support that, and panics. Instead, Shutdown
+// stops accepting connections and sends GOAWAY to the HTTP/2 ones, then the tracker waits for the pending RPCs.
+func shutdown(gsrv *grpc.Server, httpSrv *http.Server, healthChecker *healthChecker, tracker *requestTracker, drainTimeout time.Duration) {
+	start := time.Now()
+	inFlight := tracker.inFlight.Load()
+	logger.Info("shutting down: draining in-flight requests", zap.Int64("in_flight", inFlight), zap.Duration("drain_timeout", drainTimeout))
+
+	// Tell health checkers and Watch streams first, before they are cut off.
+	healthChecker.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	forced := false
+	err := httpSrv.Shutdown(ctx)
+	if err == nil {
+		err = tracker.wait(ctx)
+	}
+	if err != nil {
+		forced = true
+		logger.Warn("drain timeout expired: canceling remaining requests", zap.Int64("in_flight", tracker.inFlight.Load()), zap.Error(err))
+	}
+	// The RPCs still in flight are aborted. Count them before canceling them, the count only drops once their handlers
+	// return, after Stop.
+	aborted := tracker.inFlight.Load()
+	// Cancel the remaining RPCs, including those of hijacked HTTP/2 connections httpSrv does not track.
+	gsrv.Stop()
+	httpSrv.Close()
+
+	for _, u := range upstreams {
+		if err := u.conn.Close(); err != nil {
+			logger.Warn("could not close upstream connection", zap.String("upstream", u.name), zap.Error(err))
+		}
+	}
+	if fakeMetadata != nil {
+		fakeMetadata.Close()
+	}
+	if tracerProvider != nil {
+		// Export the spans of the drained requests. The drain timeout may have expired, Cloud Run leaves some time after it.
+		flushCtx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+		defer cancel()
+		if err := tracerProvider.Shutdown(flushCtx); err != nil {
+			logger.Warn("could not flush traces", zap.Error(err))
+		}
+		if traceFile != nil {
+			if err := traceFile.Close(); err != nil {
+				logger.Warn("could not close trace file", zap.Error(err))
+			}
+		}
+	}
+
+	logger.Info("grpc-ping: server stopped",
+		zap.Int64("in_flight", inFlight),
+		zap.Int64("drained", inFlight-aborted),
+		zap.Int64("aborted", aborted),
+		zap.Bool("forced", forced),
+		zap.Int64("total_requests", tracker.total.Load()),
+		zap.Duration("duration", time.Since(start)),
+	)
+	// Sync fails on stdout when it is not a file, e.g. a pipe, there is nothing left to do about it anyway.
+	_ = logger.Sync()
+}
@@ -0,0 +1,237 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// idTokenRefreshWindow is how long before its expiry a cached ID token is refreshed in the background.
+	idTokenRefreshWindow = 5 * time.Minute
+
+	// idTokenExpiryDelta is how long before its expiry a cached ID token is no longer handed out.
+	idTokenExpiryDelta = 30 * time.Second
+
+	// idTokenMintTimeout bounds a mint. Mints do not depend on the context of any caller, several may be waiting.
+	idTokenMintTimeout = 30 * time.Second
+)
+
+// idTokens caches the ID tokens attached to upstream requests.
+var idTokens = newIDTokenCache(idtoken.NewTokenSource)
+
+// tokenSourceFunc creates a TokenSource minting ID tokens for audience.
+type tokenSourceFunc func(ctx context.Context, audience string, opts ...idtoken.ClientOption) (oauth2.TokenSource, error)
+
+// idTokenCache is a concurrency-safe cache of ID tokens keyed by audience.
+//
+// A cached token is reused until shortly before its expiry. Once it enters the refresh window a single background
+// refresh replaces it while the current token keeps being handed out, so callers only wait for the metadata server
+// on the first request for an audience or when a token expired.
+type idTokenCache struct {
+	newTokenSource tokenSourceFunc
+
+	mu      sync.Mutex
+	entries map[string]*idTokenEntry
+
+	hits            atomic.Uint64
+	misses          atomic.Uint64
+	refreshes       atomic.Uint64
+	refreshFailures atomic.Uint64
+}
+
+// idTokenEntry holds the cached token of a single audience.
+type idTokenEntry struct {
+	mu         sync.Mutex
+	token      *oauth2.Token
+	refreshing bool
+
+	// minting is the mint callers wait for when no usable token is cached, if any.
+	minting *idTokenMint
+}
+
+// idTokenMint is a mint in flight. token and err are set before done is closed.
+type idTokenMint struct {
+	done  chan struct{}
+	token *oauth2.Token
+	err   error
+}
+
+func newIDTokenCache(newTokenSource tokenSourceFunc) *idTokenCache {
+	return &idTokenCache{
+		newTokenSource: newTokenSource,
+		entries:        make(map[string]*idTokenEntry),
+	}
+}
+
+// Token returns an ID token for audience, minting one only when no usable token is cached.
+//
+// Concurrent callers share the same mint, each of them stops waiting for it once its ctx is done.
+func (c *idTokenCache) Token(ctx context.Context, audience string) (*oauth2.Token, error) {
+	e := c.entry(audience)
+
+	e.mu.Lock()
+	if tok := e.token; tok != nil && time.Until(tok.Expiry) > idTokenExpiryDelta {
+		refresh := !e.refreshing && time.Until(tok.Expiry) < idTokenRefreshWindow
+		if refresh {
+			e.refreshing = true
+		}
+		e.mu.Unlock()
+
+		c.hits.Add(1)
+		if refresh {
+			go c.refresh(audience, e)
+		}
+		return tok, nil
+	}
+	m := e.minting
+	if m == nil {
+		m = &idTokenMint{done: make(chan struct{})}
+		e.minting = m
+		c.misses.Add(1)
+		go c.mintEntry(audience, e, m)
+	}
+	e.mu.Unlock()
+
+	select {
+	case <-m.done:
+		return m.token, m.err
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// mintEntry runs m, caching the token minted in e.
+func (c *idTokenCache) mintEntry(audience string, e *idTokenEntry, m *idTokenMint) {
+	ctx, cancel := context.WithTimeout(context.Background(), idTokenMintTimeout)
+	defer cancel()
+
+	tok, err := c.mint(ctx, audience)
+
+	e.mu.Lock()
+	if err == nil {
+		e.token = tok
+	}
+	e.minting = nil
+	e.mu.Unlock()
+
+	m.token, m.err = tok, err
+	close(m.done)
+}
+
+// Stats returns the cache counters.
+func (c *idTokenCache) Stats() idTokenCacheStats {
+	return idTokenCacheStats{
+		Hits:            c.hits.Load(),
+		Misses:          c.misses.Load(),
+		Refreshes:       c.refreshes.Load(),
+		RefreshFailures: c.refreshFailures.Load(),
+	}
+}
+
+// entry returns the entry of audience, creating it on first use.
+func (c *idTokenCache) entry(audience string) *idTokenEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[audience]
+	if !ok {
+		e = &idTokenEntry{}
+		c.entries[audience] = e
+	}
+	return e
+}
+
+// refresh replaces the cached token of e with a newly minted one.
+func (c *idTokenCache) refresh(audience string, e *idTokenEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), idTokenMintTimeout)
+	defer cancel()
+
+	tok, err := c.mint(ctx, audience)
+
+	e.mu.Lock()
+	e.refreshing = false
+	if err == nil {
+		e.token = tok
+	}
+	e.mu.Unlock()
+
+	if err != nil {
+		// The current token is still valid, the next Token call past the refresh window retries.
+		c.refreshFailures.Add(1)
+		logger.Warn("could not refresh ID token", zap.String("audience", audience), zap.Error(err))
+		return
+	}
+	c.refreshes.Add(1)
+	logger.Debug("refreshed ID token", zap.String("audience", audience), zap.Time("expiry", tok.Expiry), zap.Object("idTokenCache", c.Stats()))
+}
+
+// mint creates a new ID token for audience.
+//
+// A TokenSource returned by idtoken.NewTokenSource reuses its token until it expires,
+// so a new one is created for every mint to actually get a fresh token.
+func (c *idTokenCache) mint(ctx context.Context, audience string) (tok *oauth2.Token, err error) {
+	start := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		idTokenMintDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}()
+
+	tokenSource, err := c.newTokenSource(ctx, audience)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken.NewTokenSource: %v", err)
+	}
+	tok, err = tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("TokenSource.Token: %v", err)
+	}
+	return tok, nil
+}
+
+// idTokenCacheStats holds the counters of an idTokenCache.
+type idTokenCacheStats struct {
+	// Hits counts tokens served from the cache.
+	Hits uint64
+	// Misses counts tokens minted while the caller waited.
+	Misses uint64
+	// Refreshes counts tokens minted in the background.
+	Refreshes uint64
+	// RefreshFailures counts failed background refreshes.
+	RefreshFailures uint64
+}
+
+var _ zapcore.ObjectMarshaler = idTokenCacheStats{}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (s idTokenCacheStats) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddUint64("hits", s.Hits)
+	enc.AddUint64("misses", s.Misses)
+	enc.AddUint64("refreshes", s.Refreshes)
+	enc.AddUint64("refreshFailures", s.RefreshFailures)
+	return nil
+}
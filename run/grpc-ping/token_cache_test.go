@@ -0,0 +1,201 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeMinter mints numbered ID tokens expiring after lifetime, once release is closed if it is not nil.
+type fakeMinter struct {
+	lifetime time.Duration
+	release  chan struct{}
+	mints    atomic.Int32
+
+	mu  sync.Mutex
+	err error
+}
+
+func (m *fakeMinter) newTokenSource(ctx context.Context, audience string, opts ...idtoken.ClientOption) (oauth2.TokenSource, error) {
+	return m, nil
+}
+
+// Token implements oauth2.TokenSource.
+func (m *fakeMinter) Token() (*oauth2.Token, error) {
+	if m.release != nil {
+		<-m.release
+	}
+	m.mu.Lock()
+	err := m.err
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	n := m.mints.Add(1)
+	return &oauth2.Token{AccessToken: fmt.Sprintf("token-%d", n), Expiry: time.Now().Add(m.lifetime)}, nil
+}
+
+func (m *fakeMinter) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// waitFor polls cond until it is true, failing the test after a while.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIDTokenCacheHitAndMiss(t *testing.T) {
+	m := &fakeMinter{lifetime: time.Hour}
+	c := newIDTokenCache(m.newTokenSource)
+	ctx := context.Background()
+
+	first, err := c.Token(ctx, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Token(ctx, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AccessToken != second.AccessToken {
+		t.Errorf("Token() = %q then %q, want the cached token", first.AccessToken, second.AccessToken)
+	}
+	if _, err := c.Token(ctx, "https://other.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("hits, misses = %d, %d, want 1, 2", stats.Hits, stats.Misses)
+	}
+	if got := m.mints.Load(); got != 2 {
+		t.Errorf("minted %d tokens, want 2", got)
+	}
+}
+
+func TestIDTokenCacheConcurrentMiss(t *testing.T) {
+	m := &fakeMinter{lifetime: time.Hour, release: make(chan struct{})}
+	c := newIDTokenCache(m.newTokenSource)
+
+	const callers = 10
+	tokens := make(chan string, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tok, err := c.Token(context.Background(), testAudience)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tokens <- tok.AccessToken
+		}()
+	}
+
+	// A caller giving up does not wait for the mint, nor cancel it for the others.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Token(ctx, testAudience); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Token() with an expired context = %v, want DeadlineExceeded", err)
+	}
+
+	close(m.release)
+	wg.Wait()
+	close(tokens)
+	for tok := range tokens {
+		if tok != "token-1" {
+			t.Errorf("Token() = %q, want the single minted token", tok)
+		}
+	}
+	if got := m.mints.Load(); got != 1 {
+		t.Errorf("minted %d tokens, want 1", got)
+	}
+	if got := c.Stats().Misses; got != 1 {
+		t.Errorf("misses = %d, want 1", got)
+	}
+}
+
+func TestIDTokenCacheRefresh(t *testing.T) {
+	// Tokens enter the refresh window as soon as they are minted.
+	m := &fakeMinter{lifetime: idTokenRefreshWindow / 2}
+	c := newIDTokenCache(m.newTokenSource)
+	ctx := context.Background()
+
+	if _, err := c.Token(ctx, testAudience); err != nil {
+		t.Fatal(err)
+	}
+	// The cached token is handed out while the refresh runs.
+	tok, err := c.Token(ctx, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token-1" {
+		t.Errorf("Token() = %q, want the cached token-1", tok.AccessToken)
+	}
+	waitFor(t, func() bool { return c.Stats().Refreshes == 1 })
+
+	tok, err = c.Token(ctx, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token-2" {
+		t.Errorf("Token() = %q, want the refreshed token-2", tok.AccessToken)
+	}
+}
+
+func TestIDTokenCacheRefreshFailure(t *testing.T) {
+	m := &fakeMinter{lifetime: idTokenRefreshWindow / 2}
+	c := newIDTokenCache(m.newTokenSource)
+	ctx := context.Background()
+
+	if _, err := c.Token(ctx, testAudience); err != nil {
+		t.Fatal(err)
+	}
+	m.fail(errors.New("metadata server unavailable"))
+	if _, err := c.Token(ctx, testAudience); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return c.Stats().RefreshFailures == 1 })
+
+	tok, err := c.Token(ctx, testAudience)
+	if err != nil {
+		t.Fatalf("Token() after a failed refresh: %v", err)
+	}
+	if tok.AccessToken != "token-1" {
+		t.Errorf("Token() = %q, want the current token-1", tok.AccessToken)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bufbuild/connect-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The GRPC_PING_TRACE_EXPORTER environment variable selects where spans are exported.
+// Spans are not recorded without an exporter, but the trace context of incoming requests is still propagated upstream.
+const (
+	// traceExporterOTLP exports spans to an OpenTelemetry collector with OTLP over gRPC,
+	// configured by the standard OTEL_EXPORTER_OTLP_* environment variables.
+	traceExporterOTLP = "otlp"
+
+	// traceExporterStdout writes spans as JSON to stdout, next to the logs.
+	traceExporterStdout = "stdout"
+
+	// traceExporterFile writes spans as JSON to the file named by GRPC_PING_TRACE_FILE.
+	traceExporterFile = "file"
+)
+
+// defaultTraceFile is the file spans are written to by traceExporterFile when GRPC_PING_TRACE_FILE is not set.
+const defaultTraceFile = "traces.json"
+
+// instrumentationName identifies the spans created by the server itself.
+const instrumentationName = "github.com/zchee/go-googlecloud-samples/run/grpc-ping"
+
+// defaultServiceName is the service.name of the spans outside Cloud Run, where K_SERVICE is not set.
+const defaultServiceName = "grpc-ping"
+
+var (
+	// tracerProvider records and exports the spans of the server, if an exporter is configured.
+	tracerProvider *sdktrace.TracerProvider
+
+	// traceFile is the file spans are written to by traceExporterFile, to close once tracerProvider is shut down.
+	traceFile *os.File
+)
+
+// setupTracing installs the W3C Trace Context propagator and, when exporter is not empty, a TracerProvider exporting
+// spans with exporter. The returned TracerProvider must be shut down to flush the pending spans.
+func setupTracing(ctx context.Context, exporter, file string) (*sdktrace.TracerProvider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "":
+		return nil, nil
+
+	case traceExporterOTLP:
+		exp, err = otlptracegrpc.New(ctx)
+
+	case traceExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+	case traceExporterFile:
+		if file == "" {
+			file = defaultTraceFile
+		}
+		traceFile, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(traceFile))
+
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q: must be one of %q, %q or %q", exporter, traceExporterOTLP, traceExporterStdout, traceExporterFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	service := os.Getenv("K_SERVICE")
+	if service == "" {
+		service = defaultServiceName
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(service),
+		semconv.ServiceVersionKey.String(os.Getenv("K_REVISION")),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		// Follow the sampling decision of the caller, so a trace is either complete or absent.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp, nil
+}
+
+// TracingConnectInterceptor is a Connect handler interceptor that creates a server span for every RPC,
+// continuing the trace of the request headers.
+func TracingConnectInterceptor() connect.Interceptor {
+	return connectInterceptorFunc(func(ctx context.Context, spec connect.Spec, header http.Header, call func(ctx context.Context) error) error {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+
+		name := strings.TrimPrefix(spec.Procedure, "/")
+		service, method, _ := strings.Cut(name, "/")
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.RPCSystemKey.String("connect"),
+				semconv.RPCServiceKey.String(service),
+				semconv.RPCMethodKey.String(method),
+			),
+		)
+		defer span.End()
+
+		err := call(ctx)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(connectCode(err))))
+
+		return err
+	})
+}
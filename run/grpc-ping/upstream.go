@@ -0,0 +1,163 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+
+	pb "github.com/zchee/go-googlecloud-samples/run/grpc-ping/pkg/api/v1"
+)
+
+// defaultUpstreamName is the name of the upstream service of GRPC_PING_HOST.
+const defaultUpstreamName = "default"
+
+// upstreams are the upstream ping services requests are relayed to, GRPC_PING_HOST first, then GRPC_PING_UPSTREAMS.
+// The first one serves SendUpstream and the streaming relays, every one Broadcast.
+var upstreams []*upstream
+
+// upstream is an upstream ping service, with its own connection and circuit breaker.
+type upstream struct {
+	name string
+
+	// host should be of the form domain:port, e.g., example.com:443
+	host     string
+	insecure bool
+
+	// authenticated requests carry an ID token for audience.
+	authenticated bool
+	audience      string
+
+	conn    *grpc.ClientConn
+	breaker *circuitBreaker
+}
+
+// primaryUpstream returns the upstream service of SendUpstream and the streaming relays, or nil if none is configured.
+func primaryUpstream() *upstream {
+	if len(upstreams) == 0 {
+		return nil
+	}
+	return upstreams[0]
+}
+
+// upstreamsFromEnv returns the upstream services of the GRPC_PING_HOST, GRPC_PING_INSECURE, GRPC_PING_UNAUTHENTICATED
+// and GRPC_PING_UPSTREAMS environment variables, not connected yet.
+//
+// GRPC_PING_UPSTREAMS is a comma-separated list of name=host:port entries, each followed by ;-separated options:
+// insecure, unauthenticated, and audience=URL, e.g.
+//
+//	us=ping-us.a.run.app:443,eu=ping-eu.a.run.app:443;audience=https://ping-eu.example.com,local=localhost:8080;insecure;unauthenticated
+func upstreamsFromEnv() ([]*upstream, error) {
+	var us []*upstream
+	if host := os.Getenv("GRPC_PING_HOST"); host != "" {
+		us = append(us, newUpstream(defaultUpstreamName, host, os.Getenv("GRPC_PING_INSECURE") != "", os.Getenv("GRPC_PING_UNAUTHENTICATED") == ""))
+	}
+
+	names := make(map[string]bool, len(us))
+	for _, u := range us {
+		names[u.name] = true
+	}
+	for _, entry := range splitList(os.Getenv("GRPC_PING_UPSTREAMS")) {
+		u, err := parseUpstream(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GRPC_PING_UPSTREAMS entry %q: %w", entry, err)
+		}
+		if names[u.name] {
+			return nil, fmt.Errorf("invalid GRPC_PING_UPSTREAMS entry %q: duplicate name %q", entry, u.name)
+		}
+		names[u.name] = true
+		us = append(us, u)
+	}
+
+	return us, nil
+}
+
+func newUpstream(name, host string, insecure, authenticated bool) *upstream {
+	hostWithoutPort := strings.Split(host, ":")[0]
+	return &upstream{
+		name:          name,
+		host:          host,
+		insecure:      insecure,
+		authenticated: authenticated,
+		audience:      "https://" + hostWithoutPort,
+	}
+}
+
+// parseUpstream parses an entry of GRPC_PING_UPSTREAMS, see upstreamsFromEnv.
+func parseUpstream(entry string) (*upstream, error) {
+	options := strings.Split(entry, ";")
+	name, host, ok := strings.Cut(strings.TrimSpace(options[0]), "=")
+	if !ok || name == "" || host == "" {
+		return nil, fmt.Errorf("must be name=host:port")
+	}
+
+	u := newUpstream(name, host, false, true)
+	for _, opt := range options[1:] {
+		opt = strings.TrimSpace(opt)
+		switch {
+		case opt == "insecure":
+			u.insecure = true
+		case opt == "unauthenticated":
+			u.authenticated = false
+		case strings.HasPrefix(opt, "audience="):
+			u.audience = strings.TrimPrefix(opt, "audience=")
+		default:
+			return nil, fmt.Errorf("unknown option %q: must be insecure, unauthenticated or audience=URL", opt)
+		}
+	}
+
+	return u, nil
+}
+
+// Dial connects to the upstream service, with a circuit breaker of the GRPC_PING_BREAKER_* environment variables, and
+// upstreamRetry if it is the primary upstream service.
+func (u *upstream) Dial(ctx context.Context) error {
+	var err error
+	u.breaker, err = circuitBreakerFromEnv(u.name)
+	if err != nil {
+		return err
+	}
+
+	dialOpts := append(upstreamRetry.DialOptions(u == primaryUpstream()), u.breaker.DialOptions()...)
+	u.conn, err = NewConn(ctx, u.host, u.insecure, dialOpts...)
+	return err
+}
+
+// ping sends p to the upstream service once, with an ID token if authenticated.
+func (u *upstream) ping(ctx context.Context, p *pb.Request) (*pb.Response, error) {
+	if u.authenticated {
+		return pingRequestWithAuth(ctx, u.conn, p, u.audience)
+	}
+	return pingRequest(ctx, u.conn, p)
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler.
+func (u *upstream) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", u.name)
+	enc.AddString("host", u.host)
+	enc.AddBool("secure", !u.insecure)
+	if u.authenticated {
+		enc.AddString("audience", u.audience)
+	}
+	if u.breaker != nil {
+		return enc.AddObject("circuit_breaker", u.breaker)
+	}
+	return nil
+}